@@ -0,0 +1,131 @@
+package fpf
+
+import (
+	"strings"
+
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+)
+
+// Message is an error message.
+type Message struct {
+	Code   string                 // An identifier of the message, if any
+	Params map[string]interface{} // The parameters of the message, if any
+	Text   string
+}
+
+// String returns the message text.
+func (m Message) String() string {
+	return m.Text
+}
+
+// IncidentDetails describes an incident and the elements it concerns, for
+// rendering its error messages. Labels and IDs are those of the first
+// element of each name, empty where there isn't one.
+type IncidentDetails struct {
+	Index  int      // The position of the incident amongst the form's incidents
+	Names  []string // The names of the elements
+	Labels []string // The label text of each name, see fieldLabel
+	IDs    []string // The ID of each name
+}
+
+// Label returns the label text of the first name, or the name itself if it
+// has no label.
+func (d *IncidentDetails) Label() string {
+	if len(d.Labels) > 0 && d.Labels[0] != "" {
+		return d.Labels[0]
+	}
+	if len(d.Names) > 0 {
+		return d.Names[0]
+	}
+	return ""
+}
+
+// ID returns the ID of the first name, if any.
+func (d *IncidentDetails) ID() string {
+	if len(d.IDs) > 0 {
+		return d.IDs[0]
+	}
+	return ""
+}
+
+// TemplateMessage is an error message and the details of its incident. It
+// prints as the message text.
+type TemplateMessage struct {
+	Message
+	*IncidentDetails
+}
+
+// TemplateData is the data error templates are executed with, a list of an
+// incident's error messages. As each message prints as its text, templates
+// ranging over a list of error strings keep working, while others can use
+// the message and incident details, e.g.:
+//
+//	{{range .}}<li><a href="#{{.ID}}">{{.Label}}: {{.Text}}</a></li>{{end}}
+type TemplateData []TemplateMessage
+
+// Details returns the details of the incident.
+func (d TemplateData) Details() *IncidentDetails {
+	if len(d) == 0 {
+		return &IncidentDetails{}
+	}
+	return d[0].IncidentDetails
+}
+
+// Data returns the template data of an insertion.
+func (insertion *Insertion) Data() TemplateData {
+	names := insertion.Incident.Names
+	details := &IncidentDetails{
+		Index:  insertion.Index,
+		Names:  names,
+		Labels: make([]string, len(names)),
+		IDs:    make([]string, len(names)),
+	}
+	for i, name := range names {
+		for _, element := range insertion.Elements {
+			if attr.Attributes(element.Element.Attr).Get("name") != name {
+				continue
+			}
+
+			details.Labels[i] = fieldLabel(element)
+			details.IDs[i] = attr.Attributes(element.Element.Attr).Get("id")
+			break
+		}
+	}
+
+	messages := insertion.Incident.messages()
+	data := make(TemplateData, len(messages))
+	for i, message := range messages {
+		data[i] = TemplateMessage{Message: message, IncidentDetails: details}
+	}
+
+	return data
+}
+
+// fieldLabel returns the label text of an element. Checkboxes and radio
+// buttons are labelled by the legend of their fieldset, if any, as their own
+// labels describe a single option.
+func fieldLabel(element LabelableElement) string {
+	switch strings.ToLower(attr.Attributes(element.Element.Attr).Get("type")) {
+	case "checkbox", "radio":
+		if element.Element.Data != "input" {
+			break
+		}
+		for p := element.Element.Parent; p != nil; p = p.Parent {
+			if p.Type != html.ElementNode || p.Data != "fieldset" {
+				continue
+			}
+			for c := p.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && c.Data == "legend" {
+					return nodeText(c)
+				}
+			}
+			break
+		}
+	}
+
+	if len(element.Labels) > 0 {
+		return nodeText(element.Labels[0])
+	}
+	return ""
+}
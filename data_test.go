@@ -0,0 +1,61 @@
+package fpf
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestTemplateData(t *testing.T) {
+	html := `<form id="a"><label for="email">Email <small>(work)</small></label><input id="email" name="email"><input name="code"><fieldset><legend>Plan</legend><label><input type="radio" name="plan" value="free">Free</label><label><input type="radio" name="plan" value="pro">Pro</label></fieldset></form>`
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{
+			`<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>`,
+			`<form id="a"><label for="email" class="error">Email <small>(work)</small></label><input id="email" name="email" class="error"/><ul><li>must be valid</li><li>is taken</li></ul><input name="code" class="error"/><ul><li>is required</li></ul><fieldset><legend>Plan</legend><label class="error"><input type="radio" name="plan" value="free" class="error"/>Free</label><label class="error"><input type="radio" name="plan" value="pro" class="error"/>Pro</label><ul><li>Choose a plan.</li></ul></fieldset><ul><li>don&#39;t match</li></ul></form>`,
+		},
+		{
+			`<p>{{range $i, $name := .Details.Names}}{{$name}}={{index $.Details.Labels $i}}#{{index $.Details.IDs $i}};{{end}}</p>`,
+			`<form id="a"><label for="email" class="error">Email <small>(work)</small></label><input id="email" name="email" class="error"/><p>email=Email (work)#email;</p><input name="code" class="error"/><p>code=#;</p><fieldset><legend>Plan</legend><label class="error"><input type="radio" name="plan" value="free" class="error"/>Free</label><label class="error"><input type="radio" name="plan" value="pro" class="error"/>Pro</label><p>plan=Plan#;</p></fieldset><p>code=#;email=Email (work)#email;</p></form>`,
+		},
+		{
+			`<ul data-index="{{.Details.Index}}">{{range .}}<li><a href="#{{.ID}}">{{.Label}}: {{.Text}}</a></li>{{end}}</ul>`,
+			`<form id="a"><label for="email" class="error">Email <small>(work)</small></label><input id="email" name="email" class="error"/><ul data-index="0"><li><a href="#email">Email (work): must be valid</a></li><li><a href="#email">Email (work): is taken</a></li></ul><input name="code" class="error"/><ul data-index="1"><li><a href="#">code: is required</a></li></ul><fieldset><legend>Plan</legend><label class="error"><input type="radio" name="plan" value="free" class="error"/>Free</label><label class="error"><input type="radio" name="plan" value="pro" class="error"/>Pro</label><ul data-index="2"><li><a href="#">Plan: Choose a plan.</a></li></ul></fieldset><ul data-index="3"><li><a href="#">code: don&#39;t match</a></li></ul></form>`,
+		},
+	}
+
+	forms := []Form{
+		{
+			ID: "a",
+			Incidents: []Incident{
+				{Names: []string{"email"}, Errors: []string{"must be valid", "is taken"}},
+				{Names: []string{"code"}, Errors: []string{"is required"}},
+				{Names: []string{"plan"}, Errors: []string{"Choose a plan."}},
+				{Names: []string{"code", "email"}, Errors: []string{"don't match"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		fpf := New()
+		fpf.Fragment = true
+		fpf.IncidentInsertion = &GenericIncidentInserter{
+			ErrorClass:                   "error",
+			SingleElementErrorLocation:   After,
+			MultipleElementErrorLocation: Child,
+			Template:                     template.Must(template.New("").Parse(test.template)),
+		}
+
+		output := new(bytes.Buffer)
+		if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.want {
+			t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", test.template, output.String(), test.want)
+		}
+	}
+}
@@ -14,15 +14,63 @@ element is populated with the value.
 
 The way the value is populated depends upon the element:
 
- • textarea: the text content is populated.
+ • textarea, output: the text content is populated.
 
  • select: the option matching the value is given the attribute "selected".
+   Options without a value attribute match their text, and disabled options
+   are never selected. A select without the multiple attribute only has the
+   first match selected.
+   The options can instead be provided by Options, and AppendMissingOptions
+   appends an option for a value that matches none.
 
  • input[type=radio], input[type=checkbox]: the input is given the "checked"
-   attribute.
+   attribute. A checkbox is checked if its value is any of the values provided.
 
  • input: the input's "value" attribute is set.
 
+ • progress, meter: the "value" attribute is set if the value is a number
+   within the element's range.
+
+ • datalist: the options are replaced with the Suggestions provided for the
+   name of an input referencing the datalist with its "list" attribute.
+
+Elements populated with a single value, such as text inputs and textareas, that
+share a name are populated in document order with the values provided.
+
+A form's Defaults, such as the values of a record being edited, are used for
+names without a submitted value. Checkboxes, radio buttons and multiple selects
+absent from a submission are left unchecked rather than given their defaults.
+
+A PopulationPolicy can exclude sensitive elements from population by name,
+pattern or autocomplete token, such as card numbers and one-time codes, and
+protect elements such as CSRF tokens from being overwritten.
+
+In Reset mode, controls without a value provided are cleared of any defaults in
+the document, so that the output reflects exactly the values provided.
+
+Input values are normalised for their type: date and time values, such as
+those formatted as RFC 3339, are converted to the format of date, time,
+datetime-local, month and week inputs, and number, range, color and email
+values are checked. Values that are invalid for their type are kept, dropped or
+rejected according to InvalidValues. TypeFormatters and NameFormatters replace
+this normalisation with a ValueFormatter of your own.
+
+Partial templates, such as those returned to AJAX requests, can be filtered in
+Fragment mode so that the output isn't wrapped in html, head and body elements.
+
+Streaming
+
+ExecuteStream and ExecuteTemplateStream filter large documents as they are read
+using a tokenizer, rather than parsing them in their entirety. Only form
+controls are rewritten, and forms are only buffered when incidents need to be
+inserted in relation to the elements around them.
+
+Documents rendered repeatedly can be compiled into a Plan, which records where
+each form control sits so that only those are populated by ExecutePlan. A
+PlanCache compiles template output once per layout, the tags and the forms
+they belong to, so output differing only in text and attribute values shares a
+plan, for use with ExecuteTemplateCached.
+
 Error Message Insertion
 
 Error message insertion is achieved by providing a list of "incidents". A single
@@ -31,6 +79,68 @@ many form elements.
 
 If a discovered form element has an associated incident, the IncidentInsertion
 strategy provided is invoked to insert error messages into the HTML node tree in
-relation to the form element and its labels.
+relation to the form element and its labels. Forms and incidents can provide
+their own strategy, and RouterIncidentInserter selects a strategy by the
+element, name, type or a data-fpf-* attribute of the control concerned.
+
+Error templates are executed with TemplateData, a list of the incident's
+messages that print as their text, so templates ranging over error strings keep
+working. Each message also provides the names of the elements concerned and the
+label text and ID of each name, e.g. {{range .}}{{.Label}}: {{.Text}}{{end}}.
+Checkboxes and radio buttons are labelled by the legend of their fieldset.
+
+Templates can declare exactly where error messages go with the
+data-fpf-errors-for attribute, listing the element names whose error messages
+are inserted into the element, e.g. <div data-fpf-errors-for="email password">.
+An empty value declares the place of error messages concerning the whole form.
+
+Incidents have a Severity of error, warning, info or success, so hints such as
+"password is weak" are inserted in the same positions as errors. Each severity
+can have its own class, template, role and ID suffix, and incidents of
+different severities can concern the same element, inserted in order. Only
+errors are marked aria-invalid and listed in error summaries.
+
+An incident without any form element names concerns the whole form and its
+error messages are inserted relative to the form element. Incident names that
+match no form element are listed in the report returned by ExecuteWithReport.
+
+Reports
+
+ExecuteWithReport also reports form IDs, value names, select values and radio
+button values that matched nothing in the document, which are often caused by
+typos. In Strict mode, these are returned as an error instead.
+
+HTTP Middleware
+
+Handler wraps an http.Handler and filters its HTML responses using the forms
+attached to the request with WithForms, so templates don't need to be buffered
+and filtered by hand.
+
+Constraint Validation
+
+If Validate is enabled, form values are checked against the constraint
+attributes of their elements (required, minlength, maxlength, pattern, min, max,
+step and the email, url, number and date/time input types) before error
+message insertion. An incident is created for each element that fails, so the
+markup can be the single source of truth for basic validation rules. Only forms
+with Values are checked, as those without weren't submitted, and the values
+submitted are checked, not Defaults or those normalised or formatted for
+population.
+
+Translation
+
+Incidents can carry structured Messages with a code, parameters and fallback
+text instead of, or as well as, Errors. A Translator resolves their text in the
+Locale of their form when they are inserted. Catalog translates messages by
+locale and code, with placeholders for parameters and singular forms, and
+DefaultCatalog covers the messages of constraint validation. Handler gives
+forms without a Locale the preferred language of the request.
+
+Form Inspection
+
+Inspect discovers forms in the same way as value population and returns a
+schema of each form's named controls, their options, labels and constraints.
+This can be used to generate value whitelists, documentation and test fixtures
+from the same templates that are rendered.
 */
 package fpf
@@ -0,0 +1,154 @@
+package fpf
+
+import (
+	"sort"
+	"strings"
+)
+
+// IncidentProvider is implemented by errors that can describe themselves as
+// incidents.
+type IncidentProvider interface {
+	Incidents() []Incident
+}
+
+// FieldErrorer is implemented by errors that describe the failures of
+// individual form elements, as error messages by element name.
+type FieldErrorer interface {
+	FieldErrors() map[string][]string
+}
+
+// FieldError is an error concerning a single form element.
+type FieldError struct {
+	Name    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Name + ": " + e.Message
+}
+
+// FieldErrors is a list of errors concerning form elements.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Incidents returns an incident for each element name, in the order they
+// first appear.
+func (e FieldErrors) Incidents() []Incident {
+	incidents := make([]Incident, len(e))
+	for i, err := range e {
+		incidents[i] = Incident{Names: []string{err.Name}, Errors: []string{err.Message}}
+	}
+	return mergeIncidents(incidents)
+}
+
+// IncidentsFromMap returns an incident for each element name and its error
+// messages, sorted by name. Messages with an empty name concern the whole
+// form.
+func IncidentsFromMap(m map[string][]string) []Incident {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var incidents []Incident
+	for _, name := range names {
+		if len(m[name]) == 0 {
+			continue
+		}
+
+		incident := Incident{Errors: m[name]}
+		if name != "" {
+			incident.Names = []string{name}
+		}
+		incidents = append(incidents, incident)
+	}
+
+	return incidents
+}
+
+// IncidentsFromError returns the incidents described by an error. The error
+// tree is walked, and errors that wrap others using an Unwrap() error or
+// Unwrap() []error method, such as those created by fmt.Errorf and
+// errors.Join, are unwrapped:
+//
+//   - IncidentProvider errors provide their incidents.
+//
+//   - FieldErrorer errors provide an incident for each element name.
+//
+//   - FieldError provides an incident for its element name.
+//
+//   - Any other error, including one wrapping no errors that concern form
+//     elements, is an incident concerning the whole form.
+//
+// Incidents with the same names are merged.
+func IncidentsFromError(err error) []Incident {
+	return mergeIncidents(incidentsFromError(err))
+}
+
+func incidentsFromError(err error) []Incident {
+	switch err := err.(type) {
+	case nil:
+		return nil
+
+	case IncidentProvider:
+		return err.Incidents()
+
+	case FieldErrorer:
+		return IncidentsFromMap(err.FieldErrors())
+
+	case FieldError:
+		return []Incident{{Names: []string{err.Name}, Errors: []string{err.Message}}}
+
+	case *FieldError:
+		return []Incident{{Names: []string{err.Name}, Errors: []string{err.Message}}}
+
+	case interface{ Unwrap() []error }:
+		var incidents []Incident
+		for _, err := range err.Unwrap() {
+			incidents = append(incidents, incidentsFromError(err)...)
+		}
+		return incidents
+
+	case interface{ Unwrap() error }:
+		// Wrapped errors that concern form elements are used, otherwise the
+		// wrapping error's message is kept in its entirety
+		incidents := incidentsFromError(err.Unwrap())
+		for _, incident := range incidents {
+			if len(incident.Names) > 0 {
+				return incidents
+			}
+		}
+	}
+
+	return []Incident{{Errors: []string{err.Error()}}}
+}
+
+// mergeIncidents merges the errors of incidents with the same names and
+// severity, in the order they first appear.
+func mergeIncidents(incidents []Incident) []Incident {
+	var merged []Incident
+	index := make(map[string]int)
+	for _, incident := range incidents {
+		key := string(incident.severity()) + "\x00" + strings.Join(incident.Names, "\x00")
+		if i, ok := index[key]; ok {
+			merged[i].Errors = append(merged[i].Errors, incident.Errors...)
+			merged[i].Messages = append(merged[i].Messages, incident.Messages...)
+			continue
+		}
+
+		index[key] = len(merged)
+		incident.Errors = incident.Errors[:len(incident.Errors):len(incident.Errors)]
+		incident.Messages = incident.Messages[:len(incident.Messages):len(incident.Messages)]
+		merged = append(merged, incident)
+	}
+
+	return merged
+}
@@ -0,0 +1,114 @@
+package fpf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validationErrors map[string][]string
+
+func (e validationErrors) Error() string                    { return "validation failed" }
+func (e validationErrors) FieldErrors() map[string][]string { return e }
+
+type incidentError []Incident
+
+func (e incidentError) Error() string         { return "incidents" }
+func (e incidentError) Incidents() []Incident { return e }
+
+type joinedError []error
+
+func (e joinedError) Error() string   { return "joined" }
+func (e joinedError) Unwrap() []error { return e }
+
+func TestIncidentsFromError(t *testing.T) {
+	tests := []struct {
+		Err  error
+		Want []Incident
+	}{
+		{nil, nil},
+		{
+			errors.New("session expired"),
+			[]Incident{{Errors: []string{"session expired"}}},
+		},
+		{
+			FieldError{"email", "is invalid"},
+			[]Incident{{Names: []string{"email"}, Errors: []string{"is invalid"}}},
+		},
+		{
+			fmt.Errorf("saving user: %w", &FieldError{"email", "is taken"}),
+			[]Incident{{Names: []string{"email"}, Errors: []string{"is taken"}}},
+		},
+		{
+			fmt.Errorf("saving user: %w", errors.New("connection refused")),
+			[]Incident{{Errors: []string{"saving user: connection refused"}}},
+		},
+		{
+			FieldErrors{{"name", "is required"}, {"age", "is too low"}, {"name", "is too short"}},
+			[]Incident{
+				{Names: []string{"name"}, Errors: []string{"is required", "is too short"}},
+				{Names: []string{"age"}, Errors: []string{"is too low"}},
+			},
+		},
+		{
+			incidentError{
+				{Names: []string{"password"}, Errors: []string{"is too short"}},
+				{Names: []string{"password"}, Errors: []string{"is weak"}, Severity: SeverityWarning},
+				{Names: []string{"password"}, Errors: []string{"is common"}, Severity: SeverityWarning},
+			},
+			[]Incident{
+				{Names: []string{"password"}, Errors: []string{"is too short"}},
+				{Names: []string{"password"}, Errors: []string{"is weak", "is common"}, Severity: SeverityWarning},
+			},
+		},
+		{
+			validationErrors{"b": {"is invalid"}, "a": {"is required"}, "": {"try again"}},
+			[]Incident{
+				{Errors: []string{"try again"}},
+				{Names: []string{"a"}, Errors: []string{"is required"}},
+				{Names: []string{"b"}, Errors: []string{"is invalid"}},
+			},
+		},
+		{
+			joinedError{
+				incidentError{{Names: []string{"password", "password-confirm"}, Errors: []string{"do not match"}}},
+				FieldError{"name", "is required"},
+				errors.New("rate limited"),
+				FieldError{"name", "is too short"},
+			},
+			[]Incident{
+				{Names: []string{"password", "password-confirm"}, Errors: []string{"do not match"}},
+				{Names: []string{"name"}, Errors: []string{"is required", "is too short"}},
+				{Errors: []string{"rate limited"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got := IncidentsFromError(test.Err)
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("IncidentsFromError(%#v):\nGot:\n%v\nExpected:\n%v", test.Err, got, test.Want)
+		}
+	}
+}
+
+func TestFormError(t *testing.T) {
+	html := `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo"/></form></body></html>`
+	want := `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo" class="error"/><ul class="errors"><li>Foo is required.</li><li>Foo is too short.</li></ul></form></body></html>`
+	forms := []Form{
+		{
+			Error: FieldErrors{{"foo", "Foo is required."}, {"foo", "Foo is too short."}},
+		},
+	}
+
+	output := new(bytes.Buffer)
+	if err := New().Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
@@ -152,21 +152,21 @@ func ExampleFormPopulationFilter_ExecuteTemplate_errorInsertion() {
 		// validate username
 		if len(register.Get("username")) < 5 {
 			incidents = append(incidents, fpf.Incident{
-				[]string{"username"},
-				[]string{"Username needs to be 5 or more characters long."},
+				Names:  []string{"username"},
+				Errors: []string{"Username needs to be 5 or more characters long."},
 			})
 		}
 
 		// validate password
 		if len(register.Get("password")) < 6 {
 			incidents = append(incidents, fpf.Incident{
-				[]string{"password", "password-confirm"},
-				[]string{"Password needs to be 6 or more characters long."},
+				Names:  []string{"password", "password-confirm"},
+				Errors: []string{"Password needs to be 6 or more characters long."},
 			})
 		} else if register.Get("password") != register.Get("password-confirm") {
 			incidents = append(incidents, fpf.Incident{
-				[]string{"password", "password-confirm"},
-				[]string{"Passwords do not match."},
+				Names:  []string{"password", "password-confirm"},
+				Errors: []string{"Passwords do not match."},
 			})
 		}
 
@@ -0,0 +1,196 @@
+package fpf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+)
+
+// InvalidValuePolicy is how values that are invalid for the type of the input
+// they populate are handled.
+type InvalidValuePolicy int
+
+const (
+	// Invalid values are populated as provided.
+	KeepInvalidValues InvalidValuePolicy = iota
+
+	// Invalid values aren't populated, leaving the input as it is in the
+	// document.
+	DropInvalidValues
+
+	// Invalid values are an error, returned as an *InvalidValueError.
+	RejectInvalidValues
+)
+
+// InvalidValueError is the error returned for a value that is invalid for the
+// type of the input it populates, if invalid values are rejected.
+type InvalidValueError struct {
+	Form  string // The form ID
+	Name  string // The input name
+	Type  string // The input type
+	Value string
+	Err   error
+}
+
+func (e *InvalidValueError) Error() string {
+	return fmt.Sprintf("fpf: form %q: invalid %s value %q for %q: %v", e.Form, e.Type, e.Value, e.Name, e.Err)
+}
+
+func (e *InvalidValueError) Unwrap() error {
+	return e.Err
+}
+
+// ValueFormatter formats the values of inputs for display. An error reports
+// that the value is invalid, and it is handled by the InvalidValues policy.
+type ValueFormatter interface {
+	FormatValue(typ, name, value string) (string, error)
+}
+
+// ValueFormatterFunc is an adapter to allow the use of ordinary functions as
+// a ValueFormatter.
+type ValueFormatterFunc func(typ, name, value string) (string, error)
+
+// FormatValue calls f(typ, name, value).
+func (f ValueFormatterFunc) FormatValue(typ, name, value string) (string, error) {
+	return f(typ, name, value)
+}
+
+// colorPattern is the valid simple color production from the HTML
+// specification.
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// timeLayouts are the layouts time values are parsed with before being
+// formatted for their input type.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006-01",
+	"15:04:05.999999999",
+	"15:04",
+}
+
+// inputValue returns the value an element is populated with, formatted for
+// display if it is an input.
+func (p *processor) inputValue(formId string, n *html.Node) (string, bool, error) {
+	value, ok := p.forms[formId].value(n)
+	if !ok || n.Data != "input" {
+		return value, ok, nil
+	}
+
+	attributes := attr.Attributes(n.Attr)
+	typ := strings.ToLower(attributes.Get("type"))
+	name := attributes.Get("name")
+
+	formatter := p.NameFormatters[name]
+	if formatter == nil {
+		formatter = p.TypeFormatters[typ]
+	}
+
+	var formatted string
+	var err error
+	if formatter != nil {
+		formatted, err = formatter.FormatValue(typ, name, value)
+	} else {
+		formatted, err = normalizeValue(typ, value, attributes.Has("multiple"))
+	}
+	if err == nil {
+		return formatted, true, nil
+	}
+
+	switch p.InvalidValues {
+	case DropInvalidValues:
+		return "", false, nil
+	case RejectInvalidValues:
+		return "", false, &InvalidValueError{Form: formId, Name: name, Type: typ, Value: value, Err: err}
+	}
+
+	return value, true, nil
+}
+
+// normalizeValue returns a value in the format of the provided input type,
+// or an error if it isn't valid for the type. Empty values are always valid.
+func normalizeValue(typ, value string, multiple bool) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+
+	switch typ {
+	case "date", "datetime-local", "month", "week", "time":
+		t, ok := parseTime(value)
+		if !ok || (t.Year() == 0 && typ != "time") {
+			return "", errors.New("not a valid " + typ)
+		}
+		return formatTime(t, typ), nil
+
+	case "number", "range":
+		if !floatPattern.MatchString(value) {
+			return "", errors.New("not a valid number")
+		}
+
+	case "color":
+		if !colorPattern.MatchString(value) {
+			return "", errors.New("not a valid color")
+		}
+		return strings.ToLower(value), nil
+
+	case "email":
+		addresses := []string{value}
+		if multiple {
+			addresses = strings.Split(value, ",")
+		}
+		for i, address := range addresses {
+			addresses[i] = strings.TrimSpace(address)
+			if !emailPattern.MatchString(addresses[i]) {
+				return "", errors.New("not a valid email address")
+			}
+		}
+		return strings.Join(addresses, ","), nil
+	}
+
+	return value, nil
+}
+
+// parseTime parses a date and/or time value, such as one formatted as
+// RFC 3339 or in the format of a date or time input.
+func parseTime(value string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return parseWeek(value)
+}
+
+// formatTime formats t in the format of the provided input type, or RFC 3339
+// if the input type has no time format.
+func formatTime(t time.Time, typ string) string {
+	switch typ {
+	case "date":
+		return t.Format("2006-01-02")
+	case "datetime-local":
+		if t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format("2006-01-02T15:04")
+		}
+		return t.Format("2006-01-02T15:04:05.999")
+	case "time":
+		if t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format("15:04")
+		}
+		return t.Format("15:04:05.999")
+	case "month":
+		return t.Format("2006-01")
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,161 @@
+package fpf
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		typ      string
+		value    string
+		multiple bool
+		want     string
+		valid    bool
+	}{
+		{"date", "2024-03-05", false, "2024-03-05", true},
+		{"date", "2024-03-05T10:30:00Z", false, "2024-03-05", true},
+		{"date", "10:30", false, "", false},
+		{"date", "05/03/2024", false, "", false},
+		{"datetime-local", "2024-03-05T10:30:00+01:00", false, "2024-03-05T10:30", true},
+		{"datetime-local", "2024-03-05 10:30:15", false, "2024-03-05T10:30:15", true},
+		{"month", "2024-03-05", false, "2024-03", true},
+		{"week", "2024-01-01", false, "2024-W01", true},
+		{"week", "2024-W10", false, "2024-W10", true},
+		{"time", "10:30:00", false, "10:30", true},
+		{"time", "2024-03-05T10:30:15.5Z", false, "10:30:15.5", true},
+		{"number", "1.5e3", false, "1.5e3", true},
+		{"number", "1,500", false, "", false},
+		{"range", "abc", false, "", false},
+		{"color", "#FF00aa", false, "#ff00aa", true},
+		{"color", "red", false, "", false},
+		{"email", " user@example.com ", false, "user@example.com", true},
+		{"email", "a@example.com, b@example.com", true, "a@example.com,b@example.com", true},
+		{"email", "a@example.com, b@example.com", false, "", false},
+		{"text", "anything", false, "anything", true},
+		{"number", "", false, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := normalizeValue(test.typ, test.value, test.multiple)
+		if got != test.want || (err == nil) != test.valid {
+			t.Errorf("normalizeValue(%q, %q, %v) = %q, %v; expected %q, valid %v", test.typ, test.value, test.multiple, got, err, test.want, test.valid)
+		}
+	}
+}
+
+func TestExecuteFormat(t *testing.T) {
+	html := `<form id="a"><input type="date" name="date"><input type="number" name="count" value="1"><input type="text" name="name"></form>`
+	values := url.Values{"date": {"2024-03-05T10:30:00Z"}, "count": {"many"}, "name": {"bob"}}
+
+	upper := ValueFormatterFunc(func(typ, name, value string) (string, error) {
+		return strings.ToUpper(value), nil
+	})
+	invalid := ValueFormatterFunc(func(typ, name, value string) (string, error) {
+		return "", errors.New("no")
+	})
+
+	tests := []struct {
+		policy InvalidValuePolicy
+		types  map[string]ValueFormatter
+		names  map[string]ValueFormatter
+		want   string
+	}{
+		{
+			KeepInvalidValues, nil, nil,
+			`<form id="a"><input type="date" name="date" value="2024-03-05"/><input type="number" name="count" value="many"/><input type="text" name="name" value="bob"/></form>`,
+		},
+		{
+			DropInvalidValues, nil, nil,
+			`<form id="a"><input type="date" name="date" value="2024-03-05"/><input type="number" name="count" value="1"/><input type="text" name="name" value="bob"/></form>`,
+		},
+		{
+			DropInvalidValues, map[string]ValueFormatter{"text": upper}, map[string]ValueFormatter{"count": upper},
+			`<form id="a"><input type="date" name="date" value="2024-03-05"/><input type="number" name="count" value="MANY"/><input type="text" name="name" value="BOB"/></form>`,
+		},
+		{
+			DropInvalidValues, map[string]ValueFormatter{"text": upper}, map[string]ValueFormatter{"name": invalid},
+			`<form id="a"><input type="date" name="date" value="2024-03-05"/><input type="number" name="count" value="1"/><input type="text" name="name"/></form>`,
+		},
+	}
+
+	for _, test := range tests {
+		fpf := New()
+		fpf.Fragment = true
+		fpf.InvalidValues = test.policy
+		fpf.TypeFormatters = test.types
+		fpf.NameFormatters = test.names
+
+		output := new(bytes.Buffer)
+		if err := fpf.Execute([]Form{{ID: "a", Values: values}}, output, strings.NewReader(html)); err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.want {
+			t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), test.want)
+		}
+	}
+
+	fpf := New()
+	fpf.InvalidValues = RejectInvalidValues
+
+	err := fpf.Execute([]Form{{ID: "a", Values: values}}, new(bytes.Buffer), strings.NewReader(html))
+	var invalidErr *InvalidValueError
+	if !errors.As(err, &invalidErr) || invalidErr.Name != "count" || invalidErr.Value != "many" {
+		t.Errorf("Execute: expected *InvalidValueError for count, got %v", err)
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	html := `<form id="a"><input type="number" name="n" required><input type="number" name="price"></form>`
+	values := url.Values{"n": {"abc"}, "price": {"1500"}}
+
+	thousands := ValueFormatterFunc(func(typ, name, value string) (string, error) {
+		if len(value) <= 3 {
+			return value, nil
+		}
+		return value[:len(value)-3] + "," + value[len(value)-3:], nil
+	})
+
+	tests := []struct {
+		policy InvalidValuePolicy
+		want   string
+	}{
+		{
+			KeepInvalidValues,
+			`<form id="a"><input type="number" name="n" required="" value="abc" class="error"/><ul class="errors"><li>Please enter a valid value.</li></ul><input type="number" name="price" value="1,500"/></form>`,
+		},
+		{
+			DropInvalidValues,
+			`<form id="a"><input type="number" name="n" required="" class="error"/><ul class="errors"><li>Please enter a valid value.</li></ul><input type="number" name="price" value="1,500"/></form>`,
+		},
+	}
+
+	for _, test := range tests {
+		fpf := New()
+		fpf.Fragment = true
+		fpf.Validate = true
+		fpf.InvalidValues = test.policy
+		fpf.NameFormatters = map[string]ValueFormatter{"price": thousands}
+
+		output := new(bytes.Buffer)
+		if err := fpf.Execute([]Form{{ID: "a", Values: values}}, output, strings.NewReader(html)); err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.want {
+			t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), test.want)
+		}
+	}
+
+	fpf := New()
+	fpf.Validate = true
+	fpf.InvalidValues = RejectInvalidValues
+
+	err := fpf.Execute([]Form{{ID: "a", Values: values}}, new(bytes.Buffer), strings.NewReader(html))
+	var invalidErr *InvalidValueError
+	if !errors.As(err, &invalidErr) || invalidErr.Name != "n" {
+		t.Errorf("Execute: expected *InvalidValueError for n, got %v", err)
+	}
+}
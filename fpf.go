@@ -5,6 +5,8 @@ import (
 	"html/template"
 	"io"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/saracen/fpf/attr"
 	"golang.org/x/net/html"
@@ -14,9 +16,10 @@ import (
 type Location string
 
 const (
-	Before Location = "before"
-	After  Location = "after"
-	Child  Location = "child"
+	Before     Location = "before"
+	After      Location = "after"
+	Child      Location = "child"
+	FirstChild Location = "first-child"
 )
 
 // DefaultIncidentInserter is the default incident inserter used if no other
@@ -26,6 +29,29 @@ var DefaultIncidentInserter = &GenericIncidentInserter{
 	SingleElementErrorLocation:   After,
 	MultipleElementErrorLocation: Child,
 	Template:                     template.Must(template.New("error").Parse(`<ul class="errors">{{ range . }}<li>{{.}}</li>{{end}}</ul>`)),
+	Severities: map[Severity]SeverityStyle{
+		SeverityWarning: {
+			Class:    "warning",
+			Template: template.Must(template.New("warning").Parse(`<ul class="warnings">{{ range . }}<li>{{.}}</li>{{end}}</ul>`)),
+		},
+		SeverityInfo: {
+			Class:    "info",
+			Template: template.Must(template.New("info").Parse(`<ul class="info">{{ range . }}<li>{{.}}</li>{{end}}</ul>`)),
+		},
+		SeveritySuccess: {
+			Class:    "success",
+			Template: template.Must(template.New("success").Parse(`<ul class="success">{{ range . }}<li>{{.}}</li>{{end}}</ul>`)),
+		},
+	},
+}
+
+// SeverityStyle is the class, template, role and ID suffix a
+// GenericIncidentInserter uses for incidents of a severity.
+type SeverityStyle struct {
+	Class    string
+	Template *template.Template
+	Role     string
+	IDSuffix string // defaults to "-" followed by the severity
 }
 
 // GenericIncidentInserter provides a basic strategy for inserting error
@@ -38,8 +64,51 @@ type GenericIncidentInserter struct {
 	SingleElementErrorLocation   Location
 	MultipleElementErrorLocation Location
 
-	// The error template that will be inserted
+	// The location to insert error messages concerning the whole form,
+	// relative to the form element. Defaults to FirstChild.
+	FormErrorLocation Location
+
+	// The error template that will be inserted, executed with TemplateData
 	Template *template.Template
+
+	// Whether to mark elements with aria-invalid and associate them with the
+	// inserted error messages using aria-describedby. Inserted error messages
+	// without an ID are given one derived from the element's ID or name and
+	// IDSuffix.
+	Accessible bool
+	IDSuffix   string // defaults to "-error", see SeverityStyle
+
+	// The role and aria-live attributes given to inserted error messages, for
+	// example "alert" and "polite". No attribute is added if empty.
+	Role string
+	Live string
+
+	// The class, template and role used for incidents by severity. Empty
+	// fields, and severities without a style, use ErrorClass, Template and
+	// Role. The ID suffix of errors without a style is IDSuffix.
+	Severities map[Severity]SeverityStyle
+}
+
+// style returns the class, template and role used for incidents of a
+// severity.
+func (i *GenericIncidentInserter) style(severity Severity) SeverityStyle {
+	style := i.Severities[severity]
+	if style.Class == "" {
+		style.Class = i.ErrorClass
+	}
+	if style.Template == nil {
+		style.Template = i.Template
+	}
+	if style.Role == "" {
+		style.Role = i.Role
+	}
+	if style.IDSuffix == "" && severity == SeverityError {
+		style.IDSuffix = i.IDSuffix
+	}
+	if style.IDSuffix == "" {
+		style.IDSuffix = "-" + string(severity)
+	}
+	return style
 }
 
 // Insert uses a basic strategy for error insertions:
@@ -48,10 +117,25 @@ type GenericIncidentInserter struct {
 //
 //  • If there is only one element, the error messages are inserted beneath it
 func (i *GenericIncidentInserter) Insert(elements []LabelableElement, errors []string) error {
+	return i.InsertIncident(&Insertion{
+		Incident: Incident{Errors: errors},
+		Elements: elements,
+	})
+}
+
+// InsertIncident uses the same strategy as Insert, with the addition that
+// error messages of incidents concerning the whole form are inserted at
+// FormErrorLocation relative to the form element.
+func (i *GenericIncidentInserter) InsertIncident(insertion *Insertion) error {
+	elements := insertion.Elements
+	severity := insertion.Incident.severity()
+	style := i.style(severity)
 	buffer := new(bytes.Buffer)
 
 	// Execute template and pass in errors
-	i.Template.Execute(buffer, errors)
+	if err := style.Template.Execute(buffer, insertion.Data()); err != nil {
+		return err
+	}
 
 	errorNode, err := html.ParseFragment(buffer, &html.Node{
 		Type:     html.ElementNode,
@@ -62,16 +146,55 @@ func (i *GenericIncidentInserter) Insert(elements []LabelableElement, errors []s
 		return err
 	}
 
+	if errorNode[0].Type == html.ElementNode {
+		if style.Role != "" {
+			setAttribute(errorNode[0], "role", style.Role)
+		}
+		if i.Live != "" {
+			setAttribute(errorNode[0], "aria-live", i.Live)
+		}
+	}
+
+	// Incident is concerning the whole form
+	if len(elements) == 0 {
+		if insertion.Slot != nil {
+			insertion.place(errorNode[0], insertion.Slot, Child)
+			return nil
+		}
+		if insertion.Form == nil {
+			return nil
+		}
+
+		location := i.FormErrorLocation
+		if location == "" {
+			location = FirstChild
+		}
+		insertion.place(errorNode[0], insertion.Form, location)
+
+		return nil
+	}
+
+	// Classes already in the class attribute, such as those of another
+	// incident concerning the element, aren't added again
 	addErrorClass := func(node *html.Node) {
 		class := attr.Attributes(node.Attr).Attribute("class")
-		if class != nil {
-			class.Val += " " + i.ErrorClass
-		} else {
-			node.Attr = append(node.Attr, html.Attribute{Key: "class", Val: i.ErrorClass})
+		if class == nil {
+			node.Attr = append(node.Attr, html.Attribute{Key: "class", Val: style.Class})
+			return
+		}
+
+	next:
+		for _, c := range strings.Fields(style.Class) {
+			for _, existing := range strings.Fields(class.Val) {
+				if existing == c {
+					continue next
+				}
+			}
+			class.Val += " " + c
 		}
 	}
 
-	// Mark elements and labels with error class
+	// Mark elements and labels with the severity's class
 	for _, element := range elements {
 		addErrorClass(element.Element)
 		for _, label := range element.Labels {
@@ -79,21 +202,24 @@ func (i *GenericIncidentInserter) Insert(elements []LabelableElement, errors []s
 		}
 	}
 
+	if errorNode[0].Type == html.ElementNode && i.Accessible {
+		describe(elements, errorNode[0], style.IDSuffix, severity == SeverityError)
+	}
+
 	switch {
+	// The document declares where the incident is inserted
+	case insertion.Slot != nil:
+		insertion.place(errorNode[0], insertion.Slot, Child)
+
 	// Incident is only concerning one element
 	case len(elements) == 1:
-		switch i.SingleElementErrorLocation {
-		case Child:
-			elements[0].Element.Parent.AppendChild(errorNode[0])
-		case Before:
-			elements[0].Element.Parent.InsertBefore(errorNode[0], elements[0].Element)
-		case After:
-			if elements[0].Element.NextSibling != nil {
-				elements[0].Element.Parent.InsertBefore(errorNode[0], elements[0].Element.NextSibling)
-			} else {
-				elements[0].Element.Parent.AppendChild(errorNode[0])
-			}
+		// Form elements such as input can't have children, so child
+		// locations are relative to the element's parent
+		target := elements[0].Element
+		if i.SingleElementErrorLocation == Child || i.SingleElementErrorLocation == FirstChild {
+			target = target.Parent
 		}
+		insertion.place(errorNode[0], target, i.SingleElementErrorLocation)
 
 	// Incident concerns multiple inputs. We insert relative to the lowest
 	// common ancestor
@@ -115,21 +241,70 @@ func (i *GenericIncidentInserter) Insert(elements []LabelableElement, errors []s
 		}
 
 		ancestor := lca(elements[0].Element, elements[1:])
-		switch i.MultipleElementErrorLocation {
-		case Child:
-			ancestor.AppendChild(errorNode[0])
+		insertion.place(errorNode[0], ancestor, i.MultipleElementErrorLocation)
+	}
+
+	return nil
+}
+
+// insertLocation returns the location nodes are inserted at relative to
+// target, see insertNode.
+func insertLocation(target *html.Node, location Location) Location {
+	if target.Parent == nil {
+		switch location {
 		case Before:
-			ancestor.Parent.InsertBefore(errorNode[0], ancestor)
+			return FirstChild
 		case After:
-			if ancestor.NextSibling != nil {
-				ancestor.Parent.InsertBefore(errorNode[0], ancestor.NextSibling)
-			} else {
-				ancestor.Parent.AppendChild(errorNode[0])
-			}
+			return Child
 		}
 	}
+	return location
+}
 
-	return nil
+// insertNode inserts n at a location relative to target. Nodes inserted
+// before or after a target without a parent, such as the context element of
+// a fragment, are inserted as its first or last child instead.
+func insertNode(n, target *html.Node, location Location) {
+	switch insertLocation(target, location) {
+	case Child:
+		target.AppendChild(n)
+	case FirstChild:
+		target.InsertBefore(n, target.FirstChild)
+	case Before:
+		target.Parent.InsertBefore(n, target)
+	case After:
+		if target.NextSibling != nil {
+			target.Parent.InsertBefore(n, target.NextSibling)
+		} else {
+			target.Parent.AppendChild(n)
+		}
+	}
+}
+
+// describe marks elements as described by the error node, and as invalid if
+// invalid is set. An error node without an ID is given one ending in suffix.
+func describe(elements []LabelableElement, errorNode *html.Node, suffix string, invalid bool) {
+	id := attr.Attributes(errorNode.Attr).Get("id")
+	if id == "" {
+		attributes := attr.Attributes(elements[0].Element.Attr)
+
+		base := attributes.Get("id")
+		if base == "" {
+			base = attributes.Get("name")
+		}
+
+		id = uniqueID(elements[0].Element, strings.Join(strings.Fields(base), "-")+suffix)
+		setAttribute(errorNode, "id", id)
+	}
+
+	for _, element := range elements {
+		if invalid {
+			setAttribute(element.Element, "aria-invalid", "true")
+		}
+
+		describedBy := strings.Fields(attr.Attributes(element.Element.Attr).Get("aria-describedby"))
+		setAttribute(element.Element, "aria-describedby", strings.Join(appendUnique(describedBy, id), " "))
+	}
 }
 
 // IncidentInserter provides an interface for custom error message insertion
@@ -141,12 +316,126 @@ type IncidentInserter interface {
 	Insert(elements []LabelableElement, errors []string) error
 }
 
+// FormIncidentInserter is an IncidentInserter that is also provided with the
+// form element an incident belongs to, allowing incidents that concern the
+// whole form to be inserted. InsertIncident is called instead of Insert for
+// inserters implementing it.
+//
+// IncidentInserters that don't implement FormIncidentInserter have incidents
+// concerning the whole form inserted by DefaultIncidentInserter.
+type FormIncidentInserter interface {
+	IncidentInserter
+	InsertIncident(insertion *Insertion) error
+}
+
+// Insertion describes an incident to be inserted and the part of the document
+// it concerns.
+type Insertion struct {
+	Incident Incident
+
+	// The form element the incident belongs to, nil if it wasn't found
+	Form *html.Node
+
+	// The elements the incident concerns, empty if the incident concerns the
+	// whole form
+	Elements []LabelableElement
+
+	// The element declared as the place to insert the incident, if any. See
+	// the data-fpf-errors-for attribute.
+	Slot *html.Node
+
+	// The position of the incident amongst the form's incidents
+	Index int
+
+	// The last node inserted after, or as the first child of, each target,
+	// so that incidents inserted at the same place keep their order
+	placed map[placement]*html.Node
+}
+
+// placement is a location relative to a target node.
+type placement struct {
+	target   *html.Node
+	location Location
+}
+
+// place inserts n at a location relative to target, following any node the
+// form's previous incidents placed there.
+func (insertion *Insertion) place(n, target *html.Node, location Location) {
+	if location != After && location != FirstChild {
+		insertNode(n, target, location)
+		return
+	}
+
+	key := placement{target, location}
+	if last := insertion.placed[key]; last != nil && last.Parent != nil {
+		insertNode(n, last, After)
+	} else {
+		insertNode(n, target, location)
+	}
+	if insertion.placed != nil {
+		insertion.placed[key] = n
+	}
+}
+
 type FormPopulationFilter struct {
 	// The incident insertion strategy to use
 	IncidentInsertion IncidentInserter
 
 	IncludeHiddenInputs   bool // Whether to populate hidden input values
 	IncludePasswordInputs bool // Whether to populate password input values
+
+	// The policy deciding which other elements are populated, if any
+	Policy *PopulationPolicy
+
+	// Whether controls of provided forms without a value are reset, so that
+	// the output reflects the values provided rather than a mix of them and
+	// the defaults of the document. Checkboxes and radio buttons are
+	// unchecked, options are unselected, and values and textareas are
+	// emptied. Hidden inputs are left as they are.
+	Reset bool
+
+	// Whether to append an option to a select element for a value that
+	// matches none of its options, such as one whose options are loaded by
+	// JavaScript
+	AppendMissingOptions bool
+
+	// Whether to validate form values against the constraint attributes
+	// (required, minlength, maxlength, pattern, min, max, step and type) of
+	// their elements. Incidents are created for any values that fail.
+	Validate bool
+
+	// The messages used by validation, defaults to DefaultValidationMessages
+	ValidationMessages *ValidationMessages
+
+	// The translator resolving the text of structured messages, such as
+	// DefaultCatalog, in the locale of their form. Messages it can't
+	// translate keep their text.
+	Translator Translator
+
+	// Formatters of input values by input type and by input name, used
+	// instead of the built-in normalisation of date, time, number, color and
+	// email values. Formatters by name take precedence.
+	TypeFormatters map[string]ValueFormatter
+	NameFormatters map[string]ValueFormatter
+
+	// How values that are invalid for the type of the input they populate
+	// are handled, defaults to KeepInvalidValues
+	InvalidValues InvalidValuePolicy
+
+	// The error summary inserted into forms with incidents, if any
+	Summary *ErrorSummary
+
+	// Whether parts of the provided forms that match nothing in the document
+	// are an error. The error returned is the *Report, and no output is
+	// written.
+	Strict bool
+
+	// Whether the input is an HTML fragment, such as a partial template,
+	// rather than a whole document. Fragments are parsed in the context of
+	// FragmentContext, defaulting to a body element, and the output isn't
+	// wrapped in html, head and body elements.
+	Fragment        bool
+	FragmentContext *html.Node
 }
 
 // New returns a FormPopulationFilter with default configuration.
@@ -162,17 +451,121 @@ type processor struct {
 	document *html.Node
 	labels   []*html.Node
 	forms    map[string]*Form
+
+	// Datalist elements by ID, wherever they are in the document
+	datalists map[string]*html.Node
+
+	// The order forms were added in
+	order []string
+
+	// Whether forms not provided are discovered during traversal
+	discover bool
+
+	report *Report
 }
 
+// newProcessor returns a processor for the provided forms.
+func newProcessor(fpf *FormPopulationFilter, forms []Form) *processor {
+	p := &processor{FormPopulationFilter: fpf}
+	p.forms = make(map[string]*Form)
+	p.datalists = make(map[string]*html.Node)
+	p.report = new(Report)
+	for _, form := range forms {
+		p.addForm(form)
+	}
+
+	if p.IncidentInsertion == nil {
+		p.IncidentInsertion = DefaultIncidentInserter
+	}
+
+	return p
+}
+
+// addForm adds a copy of form to the forms being processed.
+func (p *processor) addForm(form Form) *Form {
+	if _, ok := p.forms[form.ID]; !ok {
+		p.order = append(p.order, form.ID)
+	}
+
+	if form.Error != nil {
+		form.Incidents = append(form.Incidents[:len(form.Incidents):len(form.Incidents)], IncidentsFromError(form.Error)...)
+	}
+
+	form.submitted = form.Values
+	form.labels = make(map[*html.Node][]*html.Node)
+	form.options = make(map[*html.Node][]*html.Node)
+	form.index = make(map[*html.Node]int)
+	form.occurrences = make(map[string]int)
+	p.forms[form.ID] = &form
+
+	return &form
+}
+
+// severity returns the severity of an incident.
+func (incident Incident) severity() Severity {
+	if incident.Severity == "" {
+		return SeverityError
+	}
+	return incident.Severity
+}
+
+// messages returns the error messages of an incident, including those of
+// Errors.
+func (incident Incident) messages() []Message {
+	messages := make([]Message, 0, len(incident.Errors)+len(incident.Messages))
+	for _, text := range incident.Errors {
+		messages = append(messages, Message{Text: text})
+	}
+	return append(messages, incident.Messages...)
+}
+
+// texts returns the text of an incident's error messages.
+func (incident Incident) texts() []string {
+	messages := incident.messages()
+	texts := make([]string, len(messages))
+	for i, message := range messages {
+		texts[i] = message.Text
+	}
+	return texts
+}
+
+// Severity is the level of an incident's messages.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	SeveritySuccess Severity = "success"
+)
+
 // Incident is a collection of one or more form element names and their error
 // messages.
 //
+// An incident without any form element names concerns the whole form, for
+// example when a session has expired.
+//
 // Multiple form element names are required when there's a group of elements
 // that share common errors. For example, the inputs "new-password" and
 // "new-password-confirm" can share the error "passwords do not match".
+//
+// Incidents can also carry messages that aren't errors, such as "password is
+// weak", by giving them another Severity. Incidents of different severities
+// can concern the same elements.
 type Incident struct {
 	Names  []string
 	Errors []string
+
+	// The level of the incident's messages, defaults to SeverityError
+	Severity Severity
+
+	// Structured error messages, following those of Errors, whose text is
+	// resolved by the filter's Translator when they are inserted
+	Messages []Message
+
+	// The strategy used to insert the incident, overriding those of the form
+	// and the filter
+	Inserter IncidentInserter
 }
 
 // LabelableElement contains a form element and its associated labels.
@@ -188,8 +581,41 @@ type Form struct {
 	Values    url.Values
 	Incidents []Incident
 
+	// The locale of the form's messages, such as "en-GB". See Translator.
+	Locale string
+
+	// The incident insertion strategy used for the form's incidents,
+	// overriding that of the filter
+	IncidentInsertion IncidentInserter
+
+	// Default values, such as those of a record being edited, used for
+	// element names without a value. If Values is non-nil, it's assumed to
+	// be a submission, and checkboxes, radio buttons and multiple selects
+	// absent from it are left unchecked and unselected rather than given
+	// their defaults, as browsers don't submit them in that state.
+	Defaults url.Values
+
+	// An error, such as one returned by a validator, whose incidents are
+	// added to Incidents. See IncidentsFromError.
+	Error error
+
+	// Suggestions by input name, populated as the options of the datalist
+	// element referenced by the input's list attribute
+	Suggestions map[string][]string
+
+	// Options by select name, replacing the options of the select element
+	Options map[string][]Option
+
+	// The attributes of the form's start tag, when streaming
+	start []html.Attribute
+
+	// The Values provided, a submission if non-nil. Values are replaced by
+	// those merged with Defaults, which can happen more than once when
+	// streaming.
+	submitted url.Values
+
 	// Input elements including:
-	// input, button[type="submit"], select, textarea, progress, meter
+	// input, button[type="submit"], select, textarea, output, progress, meter
 	inputs []*html.Node
 
 	// Labels associated with an input
@@ -197,6 +623,112 @@ type Form struct {
 
 	// Options associated with an input
 	options map[*html.Node][]*html.Node
+
+	// The form element, if found
+	node *html.Node
+
+	// Elements with a data-fpf-errors-for attribute
+	slots []*html.Node
+
+	// The position of an element amongst the elements sharing its name that
+	// are populated with a single value, and the number of such elements
+	index       map[*html.Node]int
+	occurrences map[string]int
+}
+
+// value returns the value an element is populated with. Elements sharing a
+// name that are populated with a single value, such as text inputs, are given
+// the values in document order.
+func (f *Form) value(input *html.Node) (string, bool) {
+	params := f.Values[attr.Attributes(input.Attr).Get("name")]
+	if i := f.index[input]; i < len(params) {
+		return params[i], true
+	}
+	return "", false
+}
+
+// applyDefaults merges a form's defaults into its values.
+func (p *processor) applyDefaults(formId string) {
+	form := p.forms[formId]
+	if len(form.Defaults) == 0 {
+		return
+	}
+
+	values := make(url.Values, len(form.Values)+len(form.Defaults))
+	for name, params := range form.Values {
+		values[name] = params
+	}
+
+	for _, input := range form.inputs {
+		name := attr.Attributes(input.Attr).Get("name")
+		if _, ok := values[name]; ok {
+			continue
+		}
+
+		defaults, ok := form.Defaults[name]
+		if !ok {
+			continue
+		}
+
+		// Elements that aren't submitted when unchecked or unselected
+		// were unchecked or unselected
+		if form.submitted != nil && !submittedWhenEmpty(input) {
+			values[name] = []string{}
+			continue
+		}
+		values[name] = defaults
+	}
+
+	form.Values = values
+}
+
+// submittedWhenEmpty reports whether an element's name is submitted when it's
+// unchecked or has nothing selected.
+func submittedWhenEmpty(n *html.Node) bool {
+	attributes := attr.Attributes(n.Attr)
+	switch n.Data {
+	case "select":
+		return !attributes.Has("multiple")
+	case "input":
+		switch strings.ToLower(attributes.Get("type")) {
+		case "checkbox", "radio":
+			return false
+		}
+	}
+	return true
+}
+
+// slot returns the first error slot declared for any of the element names,
+// or for the whole form if there are no names.
+func (f *Form) slot(names []string) *html.Node {
+	for _, slot := range f.slots {
+		declared := strings.Fields(attr.Attributes(slot.Attr).Get("data-fpf-errors-for"))
+		if len(names) == 0 && len(declared) == 0 {
+			return slot
+		}
+		for _, name := range names {
+			if contains(declared, name) {
+				return slot
+			}
+		}
+	}
+	return nil
+}
+
+// singleValued reports whether an element is populated with a single value
+// of those provided for its name.
+func singleValued(n *html.Node) bool {
+	switch n.Data {
+	case "textarea", "output", "progress", "meter":
+		return true
+	case "input":
+		switch strings.ToLower(attr.Attributes(n.Attr).Get("type")) {
+		case "checkbox", "radio", "file", "image", "submit", "reset", "button":
+			return false
+		}
+		return true
+	}
+	return false
 }
 
 type formContext struct {
@@ -223,6 +755,13 @@ func (p *processor) traverse(n *html.Node, context formContext) {
 	if n.Type == html.ElementNode {
 		attributes := attr.Attributes(n.Attr)
 
+		// Datalists can be referenced by inputs of any form
+		if n.Data == "datalist" && attributes.Has("id") {
+			if _, ok := p.datalists[attributes.Get("id")]; !ok {
+				p.datalists[attributes.Get("id")] = n
+			}
+		}
+
 		// We need to either be in the context of a form or the element has
 		// a form attribute for us to find the element interesting.
 		formAttribute := attributes.Attribute("form")
@@ -242,7 +781,20 @@ func (p *processor) traverse(n *html.Node, context formContext) {
 		// Are we interested in this form?
 		form, ok := p.forms[formId]
 		if !ok {
-			return
+			if !p.discover {
+				return
+			}
+			form = p.addForm(Form{ID: formId})
+		}
+
+		if n == context.Form && form.node == nil {
+			form.node = n
+		}
+
+		// Error slots declare where the errors of the elements they name
+		// are inserted
+		if attributes.Has("data-fpf-errors-for") {
+			form.slots = append(form.slots, n)
 		}
 
 		// Labels can either have a "for" attribute or a "Labelable Element"
@@ -268,9 +820,10 @@ func (p *processor) traverse(n *html.Node, context formContext) {
 		}
 
 		// Elements we're interested in:
-		// input, button[type="submit"], select, textarea, progress, meter
+		// input, button[type="submit"], select, textarea, output, progress,
+		// meter
 		switch n.Data {
-		case "input", "textarea", "progress", "meter":
+		case "input", "textarea", "output", "progress", "meter":
 		case "button":
 			if attributes.Get("type") != "submit" {
 				return
@@ -283,6 +836,10 @@ func (p *processor) traverse(n *html.Node, context formContext) {
 
 		// Add input to form inputs slice
 		form.inputs = append(form.inputs, n)
+		if singleValued(n) {
+			form.index[n] = form.occurrences[name]
+			form.occurrences[name]++
+		}
 
 		// Associate the label with the element if we're in the context
 		// of a label.
@@ -292,48 +849,116 @@ func (p *processor) traverse(n *html.Node, context formContext) {
 	}
 }
 
-func (p *processor) populate(formId string) {
-	for _, input := range p.forms[formId].inputs {
+// associateLabels matches labels with a "for" attribute to the input elements
+// we were interested in.
+func (p *processor) associateLabels() {
+	for _, form := range p.forms {
+		for _, label := range p.labels {
+			id := attr.Attributes(label.Attr).Get("for")
+			for _, input := range form.inputs {
+				if id == attr.Attributes(input.Attr).Get("id") {
+					form.labels[input] = append(form.labels[input], label)
+				}
+			}
+		}
+	}
+}
+
+func (p *processor) populate(formId string) error {
+	form := p.forms[formId]
+
+	for _, input := range form.inputs {
 		attributes := attr.Attributes(input.Attr)
 
 		name := attributes.Get("name")
-		if params, ok := p.forms[formId].Values[name]; ok {
+		if suggestions, ok := form.Suggestions[name]; ok && input.Data == "input" {
+			if datalist, ok := p.datalists[attributes.Get("list")]; ok {
+				suggest(datalist, suggestions)
+			}
+		}
+
+		if p.Policy.protected(input) {
+			continue
+		}
+		if p.Policy.excluded(form, input) {
+			if p.Reset {
+				resetControl(form, input)
+			}
+			continue
+		}
+
+		if params, ok := form.Values[name]; ok {
 			switch input.Data {
 			case "select":
-				if options, ok := p.forms[formId].options[input]; ok {
+				if p.AppendMissingOptions && len(params) > 0 {
+					p.appendMissingOptions(form, input, params)
+				}
+
+				options := form.options[input]
+				for _, option := range options {
+					removeAttribute(option, "selected")
+				}
+
+				// A select without the multiple attribute has the first
+				// option matching the first value that matches selected
+				multiple := attributes.Has("multiple")
+				for _, param := range params {
+					selected := false
 					for _, option := range options {
-						optionAttributes := attr.Attributes(option.Attr)
-						optionAttributes.Remove("selected")
-
-						value := optionAttributes.Get("value")
-						for _, param := range params {
-							if value == param {
-								option.Attr = append(option.Attr, html.Attribute{Key: "selected", Val: "selected"})
-							}
+						if optionDisabled(option) || optionValue(option) != param {
+							continue
+						}
+						setAttribute(option, "selected", "selected")
+						if selected = true; !multiple {
+							break
 						}
 					}
+					if selected && !multiple {
+						break
+					}
 				}
 
-			case "textarea":
-				for c := input.FirstChild; c != nil; c = c.NextSibling {
-					input.RemoveChild(c)
+			case "textarea", "output":
+				value, ok := form.value(input)
+				if !ok {
+					if p.Reset {
+						resetControl(form, input)
+					}
+					break
+				}
+
+				for input.FirstChild != nil {
+					input.RemoveChild(input.FirstChild)
 				}
 				input.AppendChild(&html.Node{
 					Type: html.TextNode,
-					Data: params[0],
+					Data: value,
 				})
 
+			case "progress", "meter":
+				value, ok := form.value(input)
+				if ok && inRange(input, value) {
+					setAttribute(input, "value", value)
+				}
+
 			default:
 				typ := attributes.Get("type")
 				switch typ {
 				case "radio":
-					fallthrough
+					value := attributes.Attribute("value")
+					removeAttribute(input, "checked")
+					if len(params) > 0 && (value == nil || value.Val == params[0]) {
+						input.Attr = append(input.Attr, html.Attribute{Key: "checked", Val: "checked"})
+					}
 
 				case "checkbox":
 					value := attributes.Attribute("value")
-					attributes.Remove("checked")
-					if value == nil || value.Val == params[0] {
-						input.Attr = append(input.Attr, html.Attribute{Key: "checked", Val: "checked"})
+					removeAttribute(input, "checked")
+					for _, param := range params {
+						if value == nil || value.Val == param {
+							input.Attr = append(input.Attr, html.Attribute{Key: "checked", Val: "checked"})
+							break
+						}
 					}
 
 				case "file", "image":
@@ -346,41 +971,299 @@ func (p *processor) populate(formId string) {
 					if typ == "hidden" && !p.IncludeHiddenInputs {
 						break
 					}
-					attributes.Remove("value")
-					input.Attr = append(input.Attr, html.Attribute{Key: "value", Val: params[0]})
+
+					// Elements sharing a name are populated in document
+					// order with the values provided
+					value, ok, err := p.inputValue(formId, input)
+					if err != nil {
+						return err
+					}
+					if !ok {
+						if p.Reset {
+							resetControl(form, input)
+						}
+						break
+					}
+					setAttribute(input, "value", value)
 				}
 			}
+		} else if p.Reset {
+			resetControl(form, input)
+		}
+	}
+
+	return nil
+}
+
+// resetControl removes the value, checkedness or selectedness of a form
+// control, for Reset mode. Hidden inputs, buttons and elements whose value
+// isn't submitted are left as they are.
+func resetControl(form *Form, n *html.Node) {
+	switch n.Data {
+	case "select":
+		for _, option := range form.options[n] {
+			removeAttribute(option, "selected")
+		}
+
+	case "textarea":
+		for n.FirstChild != nil {
+			n.RemoveChild(n.FirstChild)
+		}
+
+	case "input":
+		switch strings.ToLower(attr.Attributes(n.Attr).Get("type")) {
+		case "radio", "checkbox":
+			removeAttribute(n, "checked")
+		case "hidden", "submit", "reset", "button", "image", "file":
+		default:
+			removeAttribute(n, "value")
+		}
+	}
+}
+
+// inRange reports whether a value is a number within the range of a progress
+// or meter element. The range of a progress element is from zero to its max
+// attribute, and that of a meter element is from its min attribute to its max
+// attribute, with the attributes defaulting to zero and one.
+func inRange(n *html.Node, value string) bool {
+	if !floatPattern.MatchString(value) {
+		return false
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+
+	attributes := attr.Attributes(n.Attr)
+	bound := func(key string, fallback float64) float64 {
+		if b := attributes.Get(key); floatPattern.MatchString(b) {
+			if f, err := strconv.ParseFloat(b, 64); err == nil {
+				return f
+			}
+		}
+		return fallback
+	}
+
+	min := 0.0
+	if n.Data == "meter" {
+		min = bound("min", 0)
+	}
+	max := bound("max", 1)
+	if n.Data == "progress" && max <= 0 {
+		max = 1
+	}
+
+	return v >= min && v <= max
+}
+
+// suggest replaces the options of a datalist with the provided suggestions.
+func suggest(datalist *html.Node, suggestions []string) {
+	for datalist.FirstChild != nil {
+		datalist.RemoveChild(datalist.FirstChild)
+	}
+	for _, suggestion := range suggestions {
+		datalist.AppendChild(&html.Node{
+			Type:     html.ElementNode,
+			Data:     "option",
+			DataAtom: atom.Option,
+			Attr:     []html.Attribute{{Key: "value", Val: suggestion}},
+		})
+	}
+}
+
+// elements returns the elements an incident concerns and their labels.
+func (p *processor) elements(formId string, incident Incident) []LabelableElement {
+	form := p.forms[formId]
+
+	var elements []LabelableElement
+
+	// An incident can have multiple form element names associated with it.
+	// Here we find all of those elements and associated labels to create
+	// the LabelableElement.
+	for _, input := range form.inputs {
+		for _, name := range incident.Names {
+			if attr.Attributes(input.Attr).Get("name") != name {
+				continue
+			}
+
+			elements = append(elements, LabelableElement{
+				Element: input,
+				Labels:  form.labels[input],
+			})
 		}
 	}
+
+	return elements
 }
 
-func (p *processor) insert(formId string) error {
+func (p *processor) insert(formId string, incidents []Incident) error {
 	form := p.forms[formId]
 
-	for _, incident := range form.Incidents {
-		var elements []LabelableElement
+	placed := make(map[placement]*html.Node)
+	for index, incident := range incidents {
+		elements := p.elements(formId, incident)
 
-		// An incident can have multiple form element names associated with it.
-		// Here we find all of those elements and associated labels to create
-		// the LabelableElement.
-		for _, input := range form.inputs {
-			for _, name := range incident.Names {
-				if attr.Attributes(input.Attr).Get("name") != name {
-					continue
+		// Report names that matched no element
+		for _, name := range incident.Names {
+			matched := false
+			for _, element := range elements {
+				if attr.Attributes(element.Element.Attr).Get("name") == name {
+					matched = true
+					break
 				}
-
-				elements = append(elements, LabelableElement{
-					Element: input,
-					Labels:  form.labels[input],
-				})
 			}
+			if !matched {
+				p.report.add(Unmatched{Kind: UnmatchedIncident, Form: formId, Name: name})
+			}
+		}
+
+		slot := form.slot(incident.Names)
+		switch {
+		case len(incident.Names) == 0 && form.node == nil && slot == nil:
+			p.report.add(Unmatched{Kind: UnmatchedIncident, Form: formId})
+			continue
+		case len(incident.Names) > 0 && len(elements) == 0:
+			continue
+		}
+
+		insertion := &Insertion{
+			Incident: incident,
+			Form:     form.node,
+			Elements: elements,
+			Slot:     slot,
+			Index:    index,
+			placed:   placed,
 		}
 
-		if len(elements) > 0 {
-			if err := p.IncidentInsertion.Insert(elements, incident.Errors); err != nil {
-				return err
+		inserter := p.IncidentInsertion
+		if form.IncidentInsertion != nil {
+			inserter = form.IncidentInsertion
+		}
+		if incident.Inserter != nil {
+			inserter = incident.Inserter
+		}
+
+		if err := insertIncident(inserter, insertion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertIncident inserts an incident using the provided strategy. Incidents
+// concerning the whole form are inserted using DefaultIncidentInserter if the
+// strategy isn't a FormIncidentInserter.
+func insertIncident(inserter IncidentInserter, insertion *Insertion) error {
+	if inserter, ok := inserter.(FormIncidentInserter); ok {
+		return inserter.InsertIncident(insertion)
+	}
+	if len(insertion.Elements) > 0 {
+		return inserter.Insert(insertion.Elements, insertion.Incident.texts())
+	}
+	return DefaultIncidentInserter.InsertIncident(insertion)
+}
+
+// removeAttribute removes all of a node's attributes with the given key.
+func removeAttribute(n *html.Node, key string) {
+	attributes := n.Attr[:0]
+	for _, attribute := range n.Attr {
+		if attribute.Key != key {
+			attributes = append(attributes, attribute)
+		}
+	}
+	n.Attr = attributes
+}
+
+// setAttribute sets the value of a node's attribute, adding the attribute if
+// it doesn't exist.
+func setAttribute(n *html.Node, key, val string) {
+	if attribute := attr.Attributes(n.Attr).Attribute(key); attribute != nil {
+		attribute.Val = val
+		return
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+// uniqueID returns an ID based on base that isn't used by any element in the
+// document n belongs to.
+func uniqueID(n *html.Node, base string) string {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+
+	ids := make(map[string]bool)
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id := attr.Attributes(n.Attr).Get("id"); id != "" {
+				ids[id] = true
 			}
 		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+
+	id := base
+	for i := 2; ids[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+
+	return id
+}
+
+// process performs validation, value population and error insertion on the
+// traversed forms.
+func (p *processor) process() error {
+	p.associateLabels()
+
+	for _, formId := range p.order {
+		if err := p.processForm(formId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// processForm performs validation, value population and error insertion on a
+// traversed form.
+func (p *processor) processForm(formId string) error {
+	// generate provided select options and merge defaults
+	p.generateOptions(formId)
+	p.applyDefaults(formId)
+
+	// report unmatched parts of the form
+	if !p.check(formId) {
+		return nil
+	}
+
+	// perform constraint validation
+	incidents := p.forms[formId].Incidents
+	if p.Validate {
+		incidents = append(incidents[:len(incidents):len(incidents)], p.validate(formId)...)
+	}
+
+	// perform value population
+	if err := p.populate(formId); err != nil {
+		return err
+	}
+
+	// resolve the text of structured messages
+	incidents = p.translate(formId, incidents)
+
+	// perform error insertion
+	if err := p.insert(formId, incidents); err != nil {
+		return err
+	}
+
+	// insert error summary
+	if p.Summary != nil {
+		if err := p.summarize(formId, incidents); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -389,58 +1272,99 @@ func (p *processor) insert(formId string) error {
 // Execute reads from r, modifies forms matching the provided form IDs, and
 // writes the output to w. The input is assumed to be UTF-8 encoded.
 func (fpf *FormPopulationFilter) Execute(forms []Form, w io.Writer, r io.Reader) error {
+	_, err := fpf.ExecuteWithReport(forms, w, r)
+	return err
+}
+
+// ExecuteWithReport is like Execute but also returns a report of the parts of
+// the provided forms that matched nothing in the document.
+func (fpf *FormPopulationFilter) ExecuteWithReport(forms []Form, w io.Writer, r io.Reader) (*Report, error) {
 	var err error
 
-	p := &processor{FormPopulationFilter: fpf}
-	p.forms = make(map[string]*Form)
-	for _, form := range forms {
-		form.labels = make(map[*html.Node][]*html.Node)
-		form.options = make(map[*html.Node][]*html.Node)
-		p.forms[form.ID] = &form
+	p := newProcessor(fpf, forms)
+	if p.Fragment {
+		p.document, err = parseFragment(r, p.FragmentContext)
+	} else {
+		p.document, err = html.Parse(r)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if p.IncidentInsertion == nil {
-		p.IncidentInsertion = DefaultIncidentInserter
+	p.traverse(p.document, formContext{})
+	if err = p.process(); err != nil {
+		return nil, err
 	}
 
-	p.document, err = html.Parse(r)
-	if err != nil {
-		return err
+	if p.Strict && len(p.report.Unmatched) > 0 {
+		return p.report, p.report
 	}
 
-	p.traverse(p.document, formContext{})
+	if !p.Fragment {
+		return p.report, html.Render(w, p.document)
+	}
 
-	// Match labels to associated input elements we were interested in
-	for _, form := range p.forms {
-		for _, label := range p.labels {
-			id := attr.Attributes(label.Attr).Get("for")
-			for _, input := range p.forms[form.ID].inputs {
-				if id == attr.Attributes(input.Attr).Get("id") {
-					p.forms[form.ID].labels[input] = append(p.forms[form.ID].options[input], label)
-				}
-			}
+	return p.report, renderChildren(w, p.document)
+}
+
+// parseFragment parses an HTML fragment in the context of an element,
+// defaulting to body. The fragment's nodes are returned as the children of a
+// copy of the context element.
+func parseFragment(r io.Reader, context *html.Node) (*html.Node, error) {
+	if context == nil {
+		context = &html.Node{
+			Type:     html.ElementNode,
+			Data:     "body",
+			DataAtom: atom.Body,
 		}
+	}
+
+	nodes, err := html.ParseFragment(r, context)
+	if err != nil {
+		return nil, err
+	}
+
+	// The root keeps the context's attributes, so that a form context is
+	// matched by its ID and owns the controls of the fragment
+	root := &html.Node{
+		Type:      html.ElementNode,
+		Data:      context.Data,
+		DataAtom:  context.DataAtom,
+		Namespace: context.Namespace,
+		Attr:      append([]html.Attribute(nil), context.Attr...),
+	}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
 
-		// perform value population
-		p.populate(form.ID)
+	return root, nil
+}
 
-		// perform error insertion
-		if err = p.insert(form.ID); err != nil {
+// renderChildren renders the children of n to w.
+func renderChildren(w io.Writer, n *html.Node) error {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(w, c); err != nil {
 			return err
 		}
 	}
-
-	return html.Render(w, p.document)
+	return nil
 }
 
 // Execute executes the provided template with the provided data, modifies forms
 // matching the provided form IDs, and writes the output to w. The template
 // output is assumed to be UTF-8 encoded.
 func (fpf *FormPopulationFilter) ExecuteTemplate(forms []Form, w io.Writer, t *template.Template, data interface{}) error {
+	_, err := fpf.ExecuteTemplateWithReport(forms, w, t, data)
+	return err
+}
+
+// ExecuteTemplateWithReport is like ExecuteTemplate but also returns a report
+// of the parts of the provided forms that matched nothing in the document.
+func (fpf *FormPopulationFilter) ExecuteTemplateWithReport(forms []Form, w io.Writer, t *template.Template, data interface{}) (*Report, error) {
 	buf := new(bytes.Buffer)
 	if err := t.Execute(buf, data); err != nil {
-		return err
+		return nil, err
 	}
 
-	return fpf.Execute(forms, w, buf)
+	return fpf.ExecuteWithReport(forms, w, buf)
 }
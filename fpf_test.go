@@ -3,9 +3,13 @@ package fpf
 import (
 	"bytes"
 	"html/template"
+	"io"
 	"net/url"
 	"strings"
 	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 type fpfTest struct {
@@ -35,6 +39,26 @@ var tests = []fpfTest{
 		nil,
 	},
 
+	// checkbox group value population
+	{
+		`<!DOCTYPE html><html><head></head><body><form action="/"><input type="checkbox" name="tags" value="a" checked><input type="checkbox" name="tags" value="b"><input type="checkbox" name="tags" value="c"></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><input type="checkbox" name="tags" value="a"/><input type="checkbox" name="tags" value="b" checked="checked"/><input type="checkbox" name="tags" value="c" checked="checked"/></form></body></html>`,
+		[]Form{
+			{Values: url.Values{"tags": []string{"c", "b"}}},
+		},
+		nil,
+	},
+
+	// repeated text value population
+	{
+		`<!DOCTYPE html><html><head></head><body><form action="/"><input type="tel" name="phone" value="default"><input type="tel" name="phone"><textarea name="phone"></textarea></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><input type="tel" name="phone" value="1"/><input type="tel" name="phone" value="2"/><textarea name="phone">3</textarea></form></body></html>`,
+		[]Form{
+			{Values: url.Values{"phone": []string{"1", "2", "3"}}},
+		},
+		nil,
+	},
+
 	// select value population
 	{
 		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo"><option value="bar">bar</option></select></form></body></html>`,
@@ -47,8 +71,8 @@ var tests = []fpfTest{
 
 	// select multiple value population
 	{
-		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo"><option value="bar">bar</option><option value="foo">foo</option></select></form></body></html>`,
-		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo"><option value="bar" selected="selected">bar</option><option value="foo" selected="selected">foo</option></select></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo" multiple><option value="bar">bar</option><option value="foo">foo</option></select></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo" multiple=""><option value="bar" selected="selected">bar</option><option value="foo" selected="selected">foo</option></select></form></body></html>`,
 		[]Form{
 			{Values: url.Values{"foo": []string{"bar", "foo"}}},
 		},
@@ -57,14 +81,24 @@ var tests = []fpfTest{
 
 	// select multiple with optgroups
 	{
-		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo"><optgroup label="opt1"><option value="foo">bar</option></optgroup><optgroup label="opt2"><option value="bar">foo</option></optgroup></select></form></body></html>`,
-		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo"><optgroup label="opt1"><option value="foo" selected="selected">bar</option></optgroup><optgroup label="opt2"><option value="bar" selected="selected">foo</option></optgroup></select></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo" multiple><optgroup label="opt1"><option value="foo">bar</option></optgroup><optgroup label="opt2"><option value="bar">foo</option></optgroup></select></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo" multiple=""><optgroup label="opt1"><option value="foo" selected="selected">bar</option></optgroup><optgroup label="opt2"><option value="bar" selected="selected">foo</option></optgroup></select></form></body></html>`,
 		[]Form{
 			{Values: url.Values{"foo": []string{"bar", "foo"}}},
 		},
 		nil,
 	},
 
+	// select population with a single match, disabled options and option text
+	{
+		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo"><option value="a" selected>A</option><option value="b" disabled>B</option><optgroup label="g" disabled><option value="c">C</option></optgroup><optgroup label="h"><option> D </option><option value="e">E</option></optgroup></select></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><select name="foo"><option value="a">A</option><option value="b" disabled="">B</option><optgroup label="g" disabled=""><option value="c">C</option></optgroup><optgroup label="h"><option selected="selected"> D </option><option value="e">E</option></optgroup></select></form></body></html>`,
+		[]Form{
+			{Values: url.Values{"foo": []string{"b", "c", "D", "e"}}},
+		},
+		nil,
+	},
+
 	// textarea population
 	{
 		`<!DOCTYPE html><html><head></head><body><form action="/"><textarea name="foo">replace</textarea></form></body></html>`,
@@ -84,8 +118,8 @@ var tests = []fpfTest{
 				Values: url.Values{"foo": []string{"bar"}},
 				Incidents: []Incident{
 					{
-						[]string{"foo"},
-						[]string{"You've stumbled across an error."},
+						Names:  []string{"foo"},
+						Errors: []string{"You've stumbled across an error."},
 					},
 				},
 			},
@@ -93,6 +127,36 @@ var tests = []fpfTest{
 		nil,
 	},
 
+	// output text population
+	{
+		`<!DOCTYPE html><html><head></head><body><form action="/"><output name="total">0</output></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><output name="total">42 &amp; more</output></form></body></html>`,
+		[]Form{
+			{Values: url.Values{"total": []string{"42 & more"}}},
+		},
+		nil,
+	},
+
+	// progress and meter population within their range
+	{
+		`<!DOCTYPE html><html><head></head><body><form action="/"><progress name="p" max="10"></progress><progress name="p"></progress><meter name="m" min="5" max="10" value="6"></meter><meter name="m" value="0.5"></meter><meter name="m"></meter></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><form action="/"><progress name="p" max="10" value="7"></progress><progress name="p"></progress><meter name="m" min="5" max="10" value="6"></meter><meter name="m" value="1"></meter><meter name="m"></meter></form></body></html>`,
+		[]Form{
+			{Values: url.Values{"p": []string{"7", "7"}, "m": []string{"4", "1", "half"}}},
+		},
+		nil,
+	},
+
+	// datalist suggestion population
+	{
+		`<!DOCTYPE html><html><head></head><body><datalist id="cities"><option value="Old"></option></datalist><form action="/"><input name="city" list="cities"><input name="other" list="missing"></form></body></html>`,
+		`<!DOCTYPE html><html><head></head><body><datalist id="cities"><option value="London"></option><option value="Paris"></option></datalist><form action="/"><input name="city" list="cities"/><input name="other" list="missing"/></form></body></html>`,
+		[]Form{
+			{Suggestions: map[string][]string{"city": {"London", "Paris"}, "other": {"x"}}},
+		},
+		nil,
+	},
+
 	// incident with multiple elements insertion
 	{
 		`<!DOCTYPE html><html><head></head><body><form action="/"><div class="group"><label for="new-password">bar</label><input id="new-password" type="text" name="new-password"><label for="confirm-password">bar</label><input id="confirm-password" type="text" name="confirm-password"></div></form></body></html>`,
@@ -102,8 +166,8 @@ var tests = []fpfTest{
 				Values: url.Values{"foo": []string{"bar"}},
 				Incidents: []Incident{
 					{
-						[]string{"new-password", "confirm-password"},
-						[]string{"Passwords did not match."},
+						Names:  []string{"new-password", "confirm-password"},
+						Errors: []string{"Passwords did not match."},
 					},
 				},
 			},
@@ -122,8 +186,8 @@ var templateTests = []fpfTest{
 				Values: url.Values{"foo": []string{"bar"}},
 				Incidents: []Incident{
 					{
-						[]string{"foo"},
-						[]string{"You've stumbled across an error."},
+						Names:  []string{"foo"},
+						Errors: []string{"You've stumbled across an error."},
 					},
 				},
 			},
@@ -171,12 +235,12 @@ func TestErrorLocation(t *testing.T) {
 			Values: url.Values{"foo": []string{"bar"}},
 			Incidents: []Incident{
 				{
-					[]string{"foo"},
-					[]string{"Error with single element."},
+					Names:  []string{"foo"},
+					Errors: []string{"Error with single element."},
 				},
 				{
-					[]string{"foo1", "foo2"},
-					[]string{"Error with multiple elements"},
+					Names:  []string{"foo1", "foo2"},
+					Errors: []string{"Error with multiple elements"},
 				},
 			},
 		},
@@ -211,3 +275,285 @@ func TestErrorLocation(t *testing.T) {
 		}
 	}
 }
+
+func TestAccessibleInsertion(t *testing.T) {
+	html := `<!DOCTYPE html><html><head></head><body><form action="/"><label for="email">Email</label><input id="email" type="email" name="email" aria-describedby="email-hint"/><p id="email-error">Taken ID</p><div><input type="password" name="password"/><input type="password" name="password-confirm"/></div></form></body></html>`
+	want := `<!DOCTYPE html><html><head></head><body><form action="/"><label for="email" class="error">Email</label><input id="email" type="email" name="email" aria-describedby="email-hint email-error-2" class="error" aria-invalid="true"/><ul class="errors" role="alert" aria-live="polite" id="email-error-2"><li>Invalid email.</li></ul><p id="email-error">Taken ID</p><div><input type="password" name="password" class="error" aria-invalid="true" aria-describedby="password-error"/><input type="password" name="password-confirm" class="error" aria-invalid="true" aria-describedby="password-error"/><ul class="errors" role="alert" aria-live="polite" id="password-error"><li>Passwords do not match.</li></ul></div></form></body></html>`
+	forms := []Form{
+		{
+			Incidents: []Incident{
+				{
+					Names:  []string{"email"},
+					Errors: []string{"Invalid email."},
+				},
+				{
+					Names:  []string{"password", "password-confirm"},
+					Errors: []string{"Passwords do not match."},
+				},
+			},
+		},
+	}
+
+	ii := *DefaultIncidentInserter
+	ii.Accessible = true
+	ii.Role = "alert"
+	ii.Live = "polite"
+
+	fpf := New()
+	fpf.IncidentInsertion = &ii
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	html := `<form id="a"><label for="username">Username</label><input id="username" name="username"/><input type="password" name="password"/></form>`
+	want := `<form id="a"><div class="error-summary"><h2 class="error-summary-title">There is a problem</h2><ul class="error-summary-list"><li><a href="#password">Password is too short.</a></li></ul></div><label for="username" class="success">Username</label><input id="username" name="username" value="bob" class="success" aria-describedby="username-success"/><ul class="success" role="status" id="username-success"><li>Username is available.</li></ul><input type="password" name="password" class="error warning" aria-invalid="true" aria-describedby="password-error password-warning" id="password"/><ul class="errors" role="alert" id="password-error"><li>Password is too short.</li></ul><p class="hint" role="status" id="password-warning">Password is weak.</p></form>`
+	forms := []Form{
+		{
+			ID:     "a",
+			Values: url.Values{"username": []string{"bob"}},
+			Incidents: []Incident{
+				{Names: []string{"username"}, Errors: []string{"Username is available."}, Severity: SeveritySuccess},
+				{Names: []string{"password"}, Errors: []string{"Password is too short."}},
+				{Names: []string{"password"}, Errors: []string{"Password is weak."}, Severity: SeverityWarning},
+			},
+		},
+	}
+
+	ii := *DefaultIncidentInserter
+	ii.Accessible = true
+	ii.Role = "alert"
+	ii.Severities = map[Severity]SeverityStyle{
+		SeverityWarning: {Class: "warning", Template: template.Must(template.New("").Parse(`<p class="hint">{{range .}}{{.}}{{end}}</p>`)), Role: "status"},
+		SeveritySuccess: {Class: "success", Template: DefaultIncidentInserter.Severities[SeveritySuccess].Template, Role: "status"},
+	}
+
+	fpf := New()
+	fpf.Fragment = true
+	fpf.IncidentInsertion = &ii
+	fpf.Summary = &ErrorSummary{}
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
+
+func TestInsertionOrder(t *testing.T) {
+	html := `<form id="a"><p>Intro</p><input name="foo"/></form>`
+	want := `<form id="a"><ul class="errors"><li>first</li></ul><ul class="errors"><li>second</li></ul><p>Intro</p><input name="foo" class="error info"/><ul class="errors"><li>a</li></ul><ul class="info"><li>b</li></ul></form>`
+	forms := []Form{
+		{
+			ID: "a",
+			Incidents: []Incident{
+				{Errors: []string{"first"}},
+				{Names: []string{"foo"}, Errors: []string{"a"}},
+				{Errors: []string{"second"}, Severity: SeverityWarning},
+				{Names: []string{"foo"}, Errors: []string{"b"}, Severity: SeverityInfo},
+			},
+		},
+	}
+
+	ii := *DefaultIncidentInserter
+	ii.Severities = map[Severity]SeverityStyle{SeverityInfo: DefaultIncidentInserter.Severities[SeverityInfo]}
+
+	fpf := New()
+	fpf.Fragment = true
+	fpf.IncidentInsertion = &ii
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
+
+func TestExecuteFragment(t *testing.T) {
+	tests := []struct {
+		Input, Want string
+		Context     *html.Node
+	}{
+		{
+			`<form action="/"><input type="text" name="foo"></form><p>Partial</p>`,
+			`<form action="/"><input type="text" name="foo" value="bar" class="error"/><ul class="errors"><li>Error.</li></ul></form><p>Partial</p>`,
+			nil,
+		},
+		{
+			`<input type="text" name="foo" form="">`,
+			`<input type="text" name="foo" form="" value="bar" class="error"/><ul class="errors"><li>Error.</li></ul>`,
+			nil,
+		},
+		{
+			`<td><input type="text" name="foo" form=""></td>`,
+			`<td><input type="text" name="foo" form="" value="bar" class="error"/><ul class="errors"><li>Error.</li></ul></td>`,
+			&html.Node{Type: html.ElementNode, Data: "tr", DataAtom: atom.Tr},
+		},
+	}
+
+	forms := []Form{
+		{
+			Values: url.Values{"foo": []string{"bar"}},
+			Incidents: []Incident{
+				{
+					Names:  []string{"foo"},
+					Errors: []string{"Error."},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		fpf := New()
+		fpf.Fragment = true
+		fpf.FragmentContext = test.Context
+
+		output := new(bytes.Buffer)
+		if err := fpf.Execute(forms, output, strings.NewReader(test.Input)); err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.Want {
+			t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", test.Input, output.String(), test.Want)
+		}
+	}
+}
+
+func TestExecuteFragmentForm(t *testing.T) {
+	input := `<label for="user">User</label><input id="user" name="user"><input name="password" type="password">`
+	want := `<div class="error-summary"><h2 class="error-summary-title">There is a problem</h2><ul class="error-summary-list"><li>Session expired.</li><li><a href="#user">Unknown user.</a></li></ul></div><label for="user" class="error">User</label><input id="user" name="user" value="bob" class="error"/><ul class="errors"><li>Unknown user.</li></ul><input name="password" type="password"/><ul class="errors"><li>Session expired.</li></ul>`
+
+	forms := []Form{
+		{
+			ID:     "login",
+			Values: url.Values{"user": {"bob"}},
+			Incidents: []Incident{
+				{Errors: []string{"Session expired."}},
+				{Names: []string{"user"}, Errors: []string{"Unknown user."}},
+			},
+		},
+	}
+
+	ii := *DefaultIncidentInserter
+	ii.FormErrorLocation = After
+
+	fpf := New()
+	fpf.Fragment = true
+	fpf.FragmentContext = &html.Node{Type: html.ElementNode, Data: "form", DataAtom: atom.Form, Attr: []html.Attribute{{Key: "id", Val: "login"}}}
+	fpf.IncidentInsertion = &ii
+	fpf.Summary = &ErrorSummary{Location: Before}
+
+	output := new(bytes.Buffer)
+	report, err := fpf.ExecuteWithReport(forms, output, strings.NewReader(input))
+	if err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", input, output.String(), want)
+	}
+	if len(report.Unmatched) > 0 {
+		t.Errorf("Execute(`%s`): unmatched %v", input, report.Unmatched)
+	}
+}
+
+func TestReset(t *testing.T) {
+	html := `<form id="a"><input name="name" value="Default"><input name="phone" value="1"><input name="phone" value="2"><input type="hidden" name="token" value="t"><input type="submit" name="go" value="Go"><input type="checkbox" name="news" checked><input type="radio" name="r" value="a" checked><select name="s"><option value="1" selected>1</option></select><textarea name="notes">Default</textarea><textarea name="phone">3</textarea></form>`
+	want := `<form id="a"><input name="name"/><input name="phone" value="5"/><input name="phone"/><input type="hidden" name="token" value="t"/><input type="submit" name="go" value="Go"/><input type="checkbox" name="news"/><input type="radio" name="r" value="a"/><select name="s"><option value="1">1</option></select><textarea name="notes"></textarea><textarea name="phone"></textarea></form>`
+
+	fpf := New()
+	fpf.Fragment = true
+	fpf.Reset = true
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute([]Form{{ID: "a", Values: url.Values{"phone": {"5"}}}}, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	html := `<form id="a"><input name="name"><input name="email"><input type="checkbox" name="news" value="1"><input type="radio" name="plan" value="free"><input type="radio" name="plan" value="pro"><select name="tags" multiple><option value="a">a</option></select><select name="country"><option value="uk">UK</option><option value="fr">FR</option></select></form>`
+	defaults := url.Values{"name": {"Bob"}, "email": {"bob@example.com"}, "news": {"1"}, "plan": {"pro"}, "tags": {"a"}, "country": {"fr"}}
+
+	tests := []struct {
+		values url.Values
+		want   string
+	}{
+		// no submission
+		{
+			nil,
+			`<form id="a"><input name="name" value="Bob"/><input name="email" value="bob@example.com"/><input type="checkbox" name="news" value="1" checked="checked"/><input type="radio" name="plan" value="free"/><input type="radio" name="plan" value="pro" checked="checked"/><select name="tags" multiple=""><option value="a" selected="selected">a</option></select><select name="country"><option value="uk">UK</option><option value="fr" selected="selected">FR</option></select></form>`,
+		},
+		// submission without unchecked elements
+		{
+			url.Values{"name": {"Alice"}},
+			`<form id="a"><input name="name" value="Alice"/><input name="email" value="bob@example.com"/><input type="checkbox" name="news" value="1"/><input type="radio" name="plan" value="free"/><input type="radio" name="plan" value="pro"/><select name="tags" multiple=""><option value="a">a</option></select><select name="country"><option value="uk">UK</option><option value="fr" selected="selected">FR</option></select></form>`,
+		},
+	}
+
+	fpf := New()
+	fpf.Fragment = true
+
+	// Defaults are merged for each control when streaming
+	executes := map[string]func(forms []Form, w io.Writer, r io.Reader) error{
+		"Execute":       fpf.Execute,
+		"ExecuteStream": fpf.ExecuteStream,
+		"ExecutePlan": func(forms []Form, w io.Writer, r io.Reader) error {
+			plan, err := Compile(r)
+			if err != nil {
+				return err
+			}
+			return fpf.ExecutePlan(forms, w, plan)
+		},
+	}
+
+	for name, execute := range executes {
+		for _, test := range tests {
+			output := new(bytes.Buffer)
+			if err := execute([]Form{{ID: "a", Values: test.values, Defaults: defaults}}, output, strings.NewReader(html)); err != nil {
+				t.Error(err)
+			}
+			if output.String() != test.want {
+				t.Errorf("%s(`%s`):\nGot:\n%s\nExpected:\n%s", name, html, output.String(), test.want)
+			}
+		}
+	}
+}
+
+func TestErrorSlots(t *testing.T) {
+	html := `<form id="a"><div class="errors" data-fpf-errors-for=""></div><div data-fpf-errors-for="email password"></div><input name="email"><div><input name="password"><input name="confirm"></div><input name="name"></form>`
+	want := `<form id="a"><div class="errors" data-fpf-errors-for=""><ul class="errors"><li>Session expired.</li></ul></div><div data-fpf-errors-for="email password"><ul class="errors"><li>Invalid email.</li></ul><ul class="errors"><li>Passwords do not match.</li></ul></div><input name="email" class="error"/><div><input name="password" class="error"/><input name="confirm" class="error"/></div><input name="name" class="error"/><ul class="errors"><li>Invalid name.</li></ul></form>`
+	forms := []Form{
+		{
+			ID: "a",
+			Incidents: []Incident{
+				{Errors: []string{"Session expired."}},
+				{Names: []string{"email"}, Errors: []string{"Invalid email."}},
+				{Names: []string{"password", "confirm"}, Errors: []string{"Passwords do not match."}},
+				{Names: []string{"name"}, Errors: []string{"Invalid name."}},
+			},
+		},
+	}
+
+	fpf := New()
+	fpf.Fragment = true
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
@@ -0,0 +1,270 @@
+package fpf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type formsKey struct{}
+
+// formsHolder holds the forms attached to a request.
+type formsHolder struct {
+	mu    sync.Mutex
+	forms []Form
+}
+
+// WithForms returns a request with forms attached to its context, for a
+// Handler to filter the response with.
+//
+// If forms are already attached to the request's context, such as by a
+// Handler earlier in the chain, forms are added to them and r is returned.
+func WithForms(r *http.Request, forms ...Form) *http.Request {
+	if holder, ok := r.Context().Value(formsKey{}).(*formsHolder); ok {
+		holder.mu.Lock()
+		holder.forms = append(holder.forms, forms...)
+		holder.mu.Unlock()
+
+		return r
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), formsKey{}, &formsHolder{forms: forms}))
+}
+
+// FormsFromContext returns the forms attached to a context by WithForms.
+func FormsFromContext(ctx context.Context) []Form {
+	holder, ok := ctx.Value(formsKey{}).(*formsHolder)
+	if !ok {
+		return nil
+	}
+
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+
+	return append([]Form(nil), holder.forms...)
+}
+
+// Handler returns an http.Handler that runs text/html responses of h through
+// Execute, using the forms attached to the request with WithForms.
+//
+// HTML responses are buffered, and are written unmodified if no forms were
+// attached. Responses with a gzip Content-Encoding are decompressed before
+// being filtered and compressed again afterwards. Any other responses,
+// including those with other content encodings, are passed through as they
+// are written. If filtering fails, a 500 Internal Server Error is sent
+// instead. Forms without a Locale are given the preferred language of the
+// request's Accept-Language header.
+func (fpf *FormPopulationFilter) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(formsKey{}).(*formsHolder); !ok {
+			r = WithForms(r)
+		}
+
+		rw := &responseWriter{ResponseWriter: w, request: r}
+		h.ServeHTTP(rw, r)
+
+		// Forms without a locale use the request's preferred language
+		forms := FormsFromContext(r.Context())
+		if locale := acceptLanguage(r.Header.Get("Accept-Language")); locale != "" {
+			for i := range forms {
+				if forms[i].Locale == "" {
+					forms[i].Locale = locale
+				}
+			}
+		}
+
+		if err := rw.finish(fpf, forms); err != nil {
+			w.Header().Del("Content-Encoding")
+			w.Header().Del("Content-Length")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	})
+}
+
+// responseWriter buffers HTML responses so that they can be filtered.
+type responseWriter struct {
+	http.ResponseWriter
+
+	request *http.Request
+	status  int
+
+	decided   bool // Whether the response is to be buffered has been decided
+	buffering bool // Whether the response is being buffered
+	written   bool // Whether the header has been written to ResponseWriter
+	hijacked  bool // Whether the connection has been hijacked
+	buffer    bytes.Buffer
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+
+	// Informational responses precede the final response, so are written
+	// as they are
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hijacks the connection of the underlying ResponseWriter, after which
+// nothing is written to it.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		if w.Header().Get("Content-Type") == "" && len(b) > 0 {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.decide()
+	}
+
+	if w.buffering {
+		return w.buffer.Write(b)
+	}
+
+	w.writeHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes responses that are passed through. Buffered responses are
+// only written once the handler has returned.
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		w.decide()
+	}
+
+	if w.buffering {
+		return
+	}
+
+	w.writeHeader()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// decide decides whether the response is to be buffered.
+func (w *responseWriter) decide() {
+	w.decided = true
+
+	switch {
+	case w.request.Method == http.MethodHead,
+		w.status < 200, w.status == http.StatusNoContent, w.status == http.StatusNotModified:
+		return
+	}
+
+	switch strings.ToLower(w.Header().Get("Content-Encoding")) {
+	case "", "identity", "gzip":
+	default:
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	w.buffering = err == nil && mediaType == "text/html"
+}
+
+func (w *responseWriter) writeHeader() {
+	if w.written {
+		return
+	}
+	w.written = true
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// finish filters and writes a buffered response.
+func (w *responseWriter) finish(fpf *FormPopulationFilter, forms []Form) error {
+	if w.hijacked {
+		return nil
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.buffering {
+		w.writeHeader()
+		return nil
+	}
+
+	body := w.buffer.Bytes()
+	if len(forms) > 0 {
+		var err error
+		if body, err = w.filter(fpf, forms, body); err != nil {
+			return err
+		}
+
+		// The content has changed, so any validator no longer applies
+		w.Header().Del("ETag")
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.writeHeader()
+	w.ResponseWriter.Write(body)
+
+	return nil
+}
+
+// filter runs a response body, decompressing it if needed, through Execute.
+func (w *responseWriter) filter(fpf *FormPopulationFilter, forms []Form, body []byte) ([]byte, error) {
+	compressed := strings.EqualFold(w.Header().Get("Content-Encoding"), "gzip")
+
+	var r io.Reader = bytes.NewReader(body)
+	if compressed {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	output := new(bytes.Buffer)
+	if !compressed {
+		err := fpf.Execute(forms, output, r)
+		return output.Bytes(), err
+	}
+
+	zw := gzip.NewWriter(output)
+	if err := fpf.Execute(forms, zw, r); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return output.Bytes(), nil
+}
@@ -0,0 +1,214 @@
+package fpf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const httpTestPage = `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo"/></form></body></html>`
+
+func TestHandler(t *testing.T) {
+	forms := []Form{{Values: url.Values{"foo": []string{"bar"}}}}
+	populated := `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo" value="bar"/></form></body></html>`
+
+	gzipped := func(s string) []byte {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		Name    string
+		Handler http.HandlerFunc
+		Status  int
+		Want    string
+	}{
+		{
+			"sniffed html",
+			func(w http.ResponseWriter, r *http.Request) {
+				r = WithForms(r, forms...)
+				w.Header().Set("Content-Length", "1")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				io.WriteString(w, httpTestPage[:50])
+				io.WriteString(w, httpTestPage[50:])
+			},
+			http.StatusUnprocessableEntity,
+			populated,
+		},
+		{
+			"without forms",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				io.WriteString(w, httpTestPage)
+			},
+			http.StatusOK,
+			httpTestPage,
+		},
+		{
+			"non-html",
+			func(w http.ResponseWriter, r *http.Request) {
+				WithForms(r, forms...)
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, httpTestPage)
+				w.(http.Flusher).Flush()
+			},
+			http.StatusOK,
+			httpTestPage,
+		},
+		{
+			"gzip",
+			func(w http.ResponseWriter, r *http.Request) {
+				WithForms(r, forms...)
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Write(gzipped(httpTestPage))
+			},
+			http.StatusOK,
+			populated,
+		},
+		{
+			"invalid gzip",
+			func(w http.ResponseWriter, r *http.Request) {
+				WithForms(r, forms...)
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Encoding", "gzip")
+				io.WriteString(w, httpTestPage)
+			},
+			http.StatusInternalServerError,
+			"Internal Server Error\n",
+		},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(New().Handler(test.Handler))
+
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != test.Status {
+			t.Errorf("%s: got status %d, expected %d", test.Name, resp.StatusCode, test.Status)
+		}
+		if string(body) != test.Want {
+			t.Errorf("%s:\nGot:\n%s\nExpected:\n%s", test.Name, body, test.Want)
+		}
+		if resp.ContentLength >= 0 && resp.ContentLength != int64(len(body)) {
+			t.Errorf("%s: got Content-Length %d, expected %d", test.Name, resp.ContentLength, len(body))
+		}
+	}
+}
+
+func TestHandlerLocale(t *testing.T) {
+	want := `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo" class="error"/><ul class="errors"><li>Veuillez renseigner ce champ.</li></ul></form></body></html>`
+
+	fpf := New()
+	fpf.Translator = DefaultCatalog
+
+	ts := httptest.NewServer(fpf.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WithForms(r, Form{Incidents: []Incident{{Names: []string{"foo"}, Messages: []Message{{Code: CodeValueMissing}}}}})
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, httpTestPage)
+	})))
+	defer ts.Close()
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Language", "en;q=0.8, fr-CH")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != want {
+		t.Errorf("Got:\n%s\nExpected:\n%s", body, want)
+	}
+}
+
+func TestHandlerPassThrough(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Handler http.HandlerFunc
+		Want    string
+	}{
+		{
+			"informational status",
+			func(w http.ResponseWriter, r *http.Request) {
+				WithForms(r, Form{Values: url.Values{"foo": []string{"bar"}}})
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, httpTestPage)
+			},
+			"201 " + `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo" value="bar"/></form></body></html>`,
+		},
+		{
+			"response controller",
+			func(w http.ResponseWriter, r *http.Request) {
+				if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+					t.Errorf("SetWriteDeadline: %v", err)
+				}
+				w.Header().Set("Content-Type", "text/html")
+				io.WriteString(w, httpTestPage)
+			},
+			"200 " + httpTestPage,
+		},
+		{
+			"hijacked",
+			func(w http.ResponseWriter, r *http.Request) {
+				conn, rw, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Errorf("Hijack: %v", err)
+					return
+				}
+				defer conn.Close()
+
+				rw.WriteString("HTTP/1.1 202 Accepted\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+				rw.Flush()
+			},
+			"202 hijacked",
+		},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(New().Handler(test.Handler))
+
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		ts.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strconv.Itoa(resp.StatusCode) + " " + string(body); got != test.Want {
+			t.Errorf("%s:\nGot:\n%s\nExpected:\n%s", test.Name, got, test.Want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package fpf
+
+import (
+	"io"
+	"strings"
+
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+)
+
+// FormSchema describes a form and the named controls associated with it.
+type FormSchema struct {
+	ID       string
+	Controls []ControlSchema
+}
+
+// ControlSchema describes a named form control. Controls sharing a name, such
+// as a group of radio buttons, are described once.
+type ControlSchema struct {
+	Name    string
+	Element string // The element name, e.g. input, select, textarea
+	Type    string // The type attribute of input and button elements
+
+	// Whether more than one value can be submitted for the name
+	Multiple bool
+
+	// The values allowed by select options, radio buttons and checkboxes
+	Options []string
+
+	// The text content of associated labels
+	Labels []string
+
+	// Constraint attributes (required, minlength, maxlength, pattern, min,
+	// max, step and multiple) and their values
+	Constraints map[string]string
+
+	// The form attribute of the control, if it is associated with its form
+	// by ID rather than by being a descendant of it
+	Form string
+}
+
+// constraintAttributes are the attributes reported as constraints of a
+// control.
+var constraintAttributes = []string{"required", "minlength", "maxlength", "pattern", "min", "max", "step", "multiple"}
+
+// Inspect reads from r and returns a schema of every form found, in document
+// order. The input is assumed to be UTF-8 encoded.
+func Inspect(r io.Reader) ([]FormSchema, error) {
+	p := newProcessor(New(), nil)
+	p.discover = true
+
+	document, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p.traverse(document, formContext{})
+	p.associateLabels()
+
+	var schemas []FormSchema
+	for _, id := range p.order {
+		schemas = append(schemas, p.schema(id))
+	}
+
+	return schemas, nil
+}
+
+// schema returns the schema of a traversed form.
+func (p *processor) schema(formId string) FormSchema {
+	form := p.forms[formId]
+
+	schema := FormSchema{ID: formId}
+	index := make(map[string]int)
+	for _, input := range form.inputs {
+		attributes := attr.Attributes(input.Attr)
+		name := attributes.Get("name")
+		typ := strings.ToLower(attributes.Get("type"))
+
+		i, ok := index[name]
+		if !ok {
+			i = len(schema.Controls)
+			index[name] = i
+
+			control := ControlSchema{
+				Name:        name,
+				Element:     input.Data,
+				Constraints: make(map[string]string),
+				Form:        attributes.Get("form"),
+			}
+			if input.Data == "input" || input.Data == "button" {
+				control.Type = typ
+			}
+			schema.Controls = append(schema.Controls, control)
+		} else if typ != "radio" {
+			schema.Controls[i].Multiple = true
+		}
+		control := &schema.Controls[i]
+
+		switch {
+		case input.Data == "select":
+			for _, option := range form.options[input] {
+				control.Options = appendUnique(control.Options, optionValue(option))
+			}
+			if attributes.Has("multiple") {
+				control.Multiple = true
+			}
+
+		case typ == "radio" || typ == "checkbox":
+			value := "on"
+			if attributes.Has("value") {
+				value = attributes.Get("value")
+			}
+			control.Options = appendUnique(control.Options, value)
+		}
+
+		for _, label := range form.labels[input] {
+			control.Labels = appendUnique(control.Labels, nodeText(label))
+		}
+
+		for _, constraint := range constraintAttributes {
+			if attribute := attributes.Attribute(constraint); attribute != nil {
+				control.Constraints[constraint] = attribute.Val
+			}
+		}
+	}
+
+	return schema
+}
+
+// optionValue returns the value of an option element, which is its text
+// content if it has no value attribute.
+func optionValue(option *html.Node) string {
+	if value := attr.Attributes(option.Attr).Attribute("value"); value != nil {
+		return value.Val
+	}
+	return nodeText(option)
+}
+
+// nodeText returns the text content of a node with whitespace collapsed. The
+// content of any form controls within the node is ignored.
+func nodeText(n *html.Node) string {
+	var words []string
+
+	var text func(n *html.Node)
+	text = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			words = append(words, strings.Fields(n.Data)...)
+			return
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				switch c.Data {
+				case "select", "textarea", "datalist", "script", "style":
+					continue
+				}
+			}
+			text(c)
+		}
+	}
+	text(n)
+
+	return strings.Join(words, " ")
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -0,0 +1,53 @@
+package fpf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	input := `<!DOCTYPE html><html><head></head><body>
+<form id="register">
+	<label for="email">Email address</label>
+	<input id="email" type="email" name="email" required maxlength="100">
+	<label><input type="radio" name="plan" value="free"> Free</label>
+	<label><input type="radio" name="plan" value="paid"> Paid</label>
+	<input type="checkbox" name="tags" value="a"><input type="checkbox" name="tags" value="b">
+	<label>Country <select name="country"><optgroup label="Europe"><option value="de">Germany</option><option>France</option></optgroup></select></label>
+	<textarea name="bio"></textarea>
+	<input type="text">
+</form>
+<form><input type="search" name="q"></form>
+<input type="text" name="nickname" form="register">
+</body></html>`
+
+	want := []FormSchema{
+		{
+			ID: "register",
+			Controls: []ControlSchema{
+				{Name: "email", Element: "input", Type: "email", Labels: []string{"Email address"}, Constraints: map[string]string{"required": "", "maxlength": "100"}},
+				{Name: "plan", Element: "input", Type: "radio", Options: []string{"free", "paid"}, Labels: []string{"Free", "Paid"}, Constraints: map[string]string{}},
+				{Name: "tags", Element: "input", Type: "checkbox", Multiple: true, Options: []string{"a", "b"}, Constraints: map[string]string{}},
+				{Name: "country", Element: "select", Options: []string{"de", "France"}, Labels: []string{"Country"}, Constraints: map[string]string{}},
+				{Name: "bio", Element: "textarea", Constraints: map[string]string{}},
+				{Name: "nickname", Element: "input", Type: "text", Constraints: map[string]string{}, Form: "register"},
+			},
+		},
+		{
+			ID: "",
+			Controls: []ControlSchema{
+				{Name: "q", Element: "input", Type: "search", Constraints: map[string]string{}},
+			},
+		},
+	}
+
+	got, err := Inspect(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inspect(`%s`):\nGot:\n%#v\nExpected:\n%#v", input, got, want)
+	}
+}
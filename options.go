@@ -0,0 +1,122 @@
+package fpf
+
+import (
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Option is an option of a select element.
+type Option struct {
+	Value    string
+	Label    string // The text of the option, defaults to Value
+	Group    string // The label of the optgroup the option is in, if any
+	Disabled bool
+}
+
+// generateOptions replaces the options of the form's select elements with
+// those provided for their name.
+func (p *processor) generateOptions(formId string) {
+	form := p.forms[formId]
+
+	for _, input := range form.inputs {
+		if input.Data != "select" {
+			continue
+		}
+
+		options, ok := form.Options[attr.Attributes(input.Attr).Get("name")]
+		if !ok {
+			continue
+		}
+
+		for input.FirstChild != nil {
+			input.RemoveChild(input.FirstChild)
+		}
+		form.options[input] = nil
+
+		// Consecutive options of the same group share an optgroup
+		var group *html.Node
+		for _, option := range options {
+			parent := input
+			if option.Group != "" {
+				if group == nil || attr.Attributes(group.Attr).Get("label") != option.Group {
+					group = &html.Node{
+						Type:     html.ElementNode,
+						Data:     "optgroup",
+						DataAtom: atom.Optgroup,
+						Attr:     []html.Attribute{{Key: "label", Val: option.Group}},
+					}
+					input.AppendChild(group)
+				}
+				parent = group
+			} else {
+				group = nil
+			}
+
+			n := newOption(option)
+			parent.AppendChild(n)
+			form.options[input] = append(form.options[input], n)
+		}
+	}
+}
+
+// appendMissingOptions appends an option to a select element for each value
+// that matches none of its options. A select without the multiple attribute
+// is only given an option for the first value, and only if no values match.
+func (p *processor) appendMissingOptions(form *Form, input *html.Node, params []string) {
+	values := make(map[string]bool)
+	for _, option := range form.options[input] {
+		values[optionValue(option)] = true
+	}
+
+	if !attr.Attributes(input.Attr).Has("multiple") {
+		for _, param := range params {
+			if values[param] {
+				return
+			}
+		}
+		params = params[:1]
+	}
+
+	for _, param := range params {
+		if values[param] {
+			continue
+		}
+		values[param] = true
+
+		n := newOption(Option{Value: param})
+		input.AppendChild(n)
+		form.options[input] = append(form.options[input], n)
+	}
+}
+
+// newOption returns an option element.
+func newOption(option Option) *html.Node {
+	label := option.Label
+	if label == "" {
+		label = option.Value
+	}
+
+	n := &html.Node{
+		Type:     html.ElementNode,
+		Data:     "option",
+		DataAtom: atom.Option,
+		Attr:     []html.Attribute{{Key: "value", Val: option.Value}},
+	}
+	if option.Disabled {
+		n.Attr = append(n.Attr, html.Attribute{Key: "disabled", Val: "disabled"})
+	}
+	n.AppendChild(&html.Node{Type: html.TextNode, Data: label})
+
+	return n
+}
+
+// optionDisabled reports whether an option, or the optgroup it is in, is
+// disabled.
+func optionDisabled(option *html.Node) bool {
+	if attr.Attributes(option.Attr).Has("disabled") {
+		return true
+	}
+	parent := option.Parent
+	return parent != nil && parent.Type == html.ElementNode && parent.Data == "optgroup" && attr.Attributes(parent.Attr).Has("disabled")
+}
@@ -0,0 +1,76 @@
+package fpf
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		html   string
+		want   string
+		form   Form
+		append bool
+	}{
+		// generated options and groups
+		{
+			`<form id="a"><select name="s"><option value="old">Old</option></select></form>`,
+			`<form id="a"><select name="s"><option value="">Choose</option><optgroup label="Fruit"><option value="apple">Apple</option><option value="pear" disabled="disabled">pear</option></optgroup><optgroup label="Veg"><option value="kale" selected="selected">Kale</option></optgroup><option value="none">None</option></select></form>`,
+			Form{
+				ID:     "a",
+				Values: url.Values{"s": {"kale"}},
+				Options: map[string][]Option{
+					"s": {
+						{Value: "", Label: "Choose"},
+						{Value: "apple", Label: "Apple", Group: "Fruit"},
+						{Value: "pear", Group: "Fruit", Disabled: true},
+						{Value: "kale", Label: "Kale", Group: "Veg"},
+						{Value: "none", Label: "None"},
+					},
+				},
+			},
+			false,
+		},
+		// missing options of a multiple select
+		{
+			`<form id="a"><select name="tags" multiple><option value="go">Go</option></select></form>`,
+			`<form id="a"><select name="tags" multiple=""><option value="go" selected="selected">Go</option><option value="rust" selected="selected">rust</option><option value="zig" selected="selected">zig</option></select></form>`,
+			Form{ID: "a", Values: url.Values{"tags": {"go", "rust", "zig", "rust"}}},
+			true,
+		},
+		// missing option of a select
+		{
+			`<form id="a"><select name="s"><option value="1">1</option></select><select name="t"><option value="1">1</option></select></form>`,
+			`<form id="a"><select name="s"><option value="1">1</option><option value="2" selected="selected">2</option></select><select name="t"><option value="1" selected="selected">1</option></select></form>`,
+			Form{ID: "a", Values: url.Values{"s": {"2", "3"}, "t": {"2", "1"}}},
+			true,
+		},
+		// missing options aren't appended by default
+		{
+			`<form id="a"><select name="s"><option value="1">1</option></select></form>`,
+			`<form id="a"><select name="s"><option value="1">1</option></select></form>`,
+			Form{ID: "a", Values: url.Values{"s": {"2"}}},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		fpf := New()
+		fpf.Fragment = true
+		fpf.AppendMissingOptions = test.append
+
+		output := new(bytes.Buffer)
+		report, err := fpf.ExecuteWithReport([]Form{test.form}, output, strings.NewReader(test.html))
+		if err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.want {
+			t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", test.html, output.String(), test.want)
+		}
+		if test.append && len(report.Unmatched) > 0 {
+			t.Errorf("ExecuteWithReport(`%s`): unexpected report %v", test.html, report)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package fpf
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"html/template"
+	"io"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Plan is a document that has been scanned in advance, recording where each
+// form and form control sits, so that it can be filtered repeatedly without
+// being parsed and traversed each time.
+//
+// A Plan is safe for concurrent use.
+type Plan struct {
+	segments []segment
+}
+
+// Compile scans a document and returns a Plan for filtering it with
+// ExecutePlan.
+func Compile(r io.Reader) (*Plan, error) {
+	plan := &Plan{}
+
+	s := newScanner(r)
+	for {
+		seg, err := s.next()
+		if err == io.EOF {
+			return plan, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if seg.kind == controlSegment {
+			if seg.nodes, err = parseFragment(bytes.NewReader(seg.raw), nil); err != nil {
+				return nil, err
+			}
+		}
+		seg.layout, _, _ = segmentLayout(seg.raw, seg.tokens)
+		plan.segments = append(plan.segments, seg)
+	}
+}
+
+// ExecutePlan is like ExecuteStream, but filters a compiled document. Only
+// the recorded form controls are populated, and forms are only parsed and
+// traversed when incidents need to be inserted.
+func (fpf *FormPopulationFilter) ExecutePlan(forms []Form, w io.Writer, plan *Plan) error {
+	i := 0
+	return newProcessor(fpf, forms).stream(func() (segment, error) {
+		if i == len(plan.segments) {
+			return segment{}, io.EOF
+		}
+		i++
+		return plan.segments[i-1], nil
+	}, w)
+}
+
+// DefaultPlanCacheSize is the number of plans a PlanCache holds if its Size
+// isn't set.
+const DefaultPlanCacheSize = 64
+
+// PlanCache holds the plans of compiled documents by a key identifying their
+// source, such as a template. A held plan is used for any document of the same
+// key with the same layout: the same tags, form start tags and form attributes
+// of form controls. Documents differing only in text and attribute values, such
+// as a CSRF token or a user's name, share a plan, so a template is only
+// compiled once for each layout it produces. The zero value is ready to use.
+//
+// A PlanCache is safe for concurrent use.
+type PlanCache struct {
+	// The maximum number of plans held. Once reached, the least recently
+	// used plan is evicted before another is added.
+	Size int
+
+	mu    sync.Mutex
+	plans map[interface{}][]*list.Element
+	order *list.List // Most recently used first
+}
+
+// cachedPlan is a plan held by a PlanCache.
+type cachedPlan struct {
+	key  interface{}
+	plan *Plan
+}
+
+// Plan returns a plan of a document, using a plan held for key if one has the
+// document's layout, otherwise compiling the document. key must be
+// comparable. The plan refers to document, which must not be modified while
+// the plan is in use.
+func (c *PlanCache) Plan(key interface{}, document []byte) (*Plan, error) {
+	c.mu.Lock()
+	candidates := append([]*list.Element(nil), c.plans[key]...)
+	plans := make([]*Plan, len(candidates))
+	for i, e := range candidates {
+		plans[i] = e.Value.(*cachedPlan).plan
+	}
+	c.mu.Unlock()
+
+	for i, cached := range plans {
+		if plan, ok := cached.bind(document); ok {
+			c.mu.Lock()
+			c.order.MoveToFront(candidates[i])
+			c.mu.Unlock()
+			return plan, nil
+		}
+	}
+
+	plan, err := Compile(bytes.NewReader(document))
+	if err != nil {
+		return nil, err
+	}
+
+	size := c.Size
+	if size <= 0 {
+		size = DefaultPlanCacheSize
+	}
+
+	c.mu.Lock()
+	if c.plans == nil {
+		c.plans = make(map[interface{}][]*list.Element)
+		c.order = list.New()
+	}
+	for c.order.Len() >= size {
+		c.evict(c.order.Back())
+	}
+	c.plans[key] = append(c.plans[key], c.order.PushFront(&cachedPlan{key: key, plan: plan}))
+	c.mu.Unlock()
+
+	return plan, nil
+}
+
+// evict removes a plan from the cache.
+func (c *PlanCache) evict(e *list.Element) {
+	key := e.Value.(*cachedPlan).key
+	c.order.Remove(e)
+
+	var plans []*list.Element
+	for _, p := range c.plans[key] {
+		if p != e {
+			plans = append(plans, p)
+		}
+	}
+	if len(plans) == 0 {
+		delete(c.plans, key)
+		return
+	}
+	c.plans[key] = plans
+}
+
+// bind returns a plan of a document with the same layout as the plan's, with
+// the content of the segments taken from the document. Segments whose markup
+// differs from the plan's are tokenized to check their layout, and controls
+// amongst them are parsed again when filtered.
+func (plan *Plan) bind(document []byte) (*Plan, bool) {
+	bound := &Plan{segments: make([]segment, len(plan.segments))}
+
+	offset := 0
+	for i, seg := range plan.segments {
+		end := offset + len(seg.raw)
+		if end > len(document) || !bytes.Equal(document[offset:end], seg.raw) {
+			layout, n, ok := segmentLayout(document[offset:], seg.tokens)
+			if !ok || layout != seg.layout {
+				return nil, false
+			}
+			end = offset + n
+			seg.raw = document[offset:end:end]
+			seg.nodes = nil
+		}
+
+		bound.segments[i] = seg
+		offset = end
+	}
+
+	return bound, offset == len(document)
+}
+
+// segmentLayout returns a hash of the layout of the first tokens of a
+// segment's markup, and the length of their markup. The layout is what the
+// segments of a scanned document depend on, see scanner.scan.
+func segmentLayout(markup []byte, tokens int) ([sha256.Size]byte, int, bool) {
+	h := sha256.New()
+	z := html.NewTokenizer(bytes.NewReader(markup))
+
+	n := 0
+	for i := 0; i < tokens; i++ {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return [sha256.Size]byte{}, 0, false
+		}
+		n += len(z.Raw())
+
+		h.Write([]byte{byte(tt)})
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, hasAttr := z.TagName()
+			h.Write(name)
+			h.Write([]byte{0})
+
+			// The attributes of forms, which are recorded, and the
+			// attribute a control is associated with a form by
+			form := tt != html.EndTagToken && string(name) == "form"
+			var associated string
+			if tt != html.EndTagToken && controlElements[string(name)] {
+				associated = "form"
+			}
+			for hasAttr && (form || associated != "") {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if form || string(key) == associated {
+					h.Write(key)
+					h.Write([]byte{0})
+					h.Write(val)
+					h.Write([]byte{0})
+				}
+			}
+		}
+	}
+
+	var layout [sha256.Size]byte
+	h.Sum(layout[:0])
+	return layout, n, true
+}
+
+// ExecuteTemplateCached is like ExecuteTemplate, but filters the template
+// output using a plan held in cache for the template. See ExecutePlan.
+func (fpf *FormPopulationFilter) ExecuteTemplateCached(cache *PlanCache, forms []Form, w io.Writer, t *template.Template, data interface{}) error {
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, data); err != nil {
+		return err
+	}
+
+	plan, err := cache.Plan(t, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return fpf.ExecutePlan(forms, w, plan)
+}
+
+// cloneNode returns a deep copy of n.
+func cloneNode(n *html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(cloneNode(c))
+	}
+	return clone
+}
@@ -0,0 +1,143 @@
+package fpf
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExecutePlan(t *testing.T) {
+	document := `<p>Intro</p><form id="a"><label for="foo">Foo</label><input id="foo" name="foo"><select name="s"><option value="1">1</option><option value="2">2</option></select></form><p>Outro</p>`
+
+	tests := []struct {
+		want  string
+		forms []Form
+	}{
+		{
+			`<p>Intro</p><form id="a"><label for="foo">Foo</label><input id="foo" name="foo" value="x"/><select name="s"><option value="1">1</option><option value="2" selected="selected">2</option></select></form><p>Outro</p>`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"x"}, "s": {"2"}}}},
+		},
+		{
+			`<p>Intro</p><form id="a"><label for="foo">Foo</label><input id="foo" name="foo" value="y"/><select name="s"><option value="1" selected="selected">1</option><option value="2">2</option></select></form><p>Outro</p>`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"y"}, "s": {"1"}}}},
+		},
+		{
+			`<p>Intro</p><form id="a"><label for="foo" class="error">Foo</label><input id="foo" name="foo" value="z" class="error"/><ul class="errors"><li>Invalid</li></ul><select name="s"><option value="1">1</option><option value="2">2</option></select></form><p>Outro</p>`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"z"}}, Incidents: []Incident{{Names: []string{"foo"}, Errors: []string{"Invalid"}}}}},
+		},
+		{
+			document,
+			nil,
+		},
+	}
+
+	plan, err := Compile(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fpf := New()
+	for _, test := range tests {
+		output := new(bytes.Buffer)
+		if err := fpf.ExecutePlan(test.forms, output, plan); err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.want {
+			t.Errorf("ExecutePlan(%v):\nGot:\n%s\nExpected:\n%s", test.forms, output.String(), test.want)
+		}
+	}
+}
+
+func TestPlanCache(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`<form id="a"><input type="hidden" name="csrf" value="{{.Token}}"><p>Hello {{.User}}</p><input name="{{.Name}}"></form>`))
+
+	cache := &PlanCache{Size: 2}
+	fpf := New()
+
+	// Output differing in text and attribute values shares a plan
+	for i, name := range []string{"foo", "foo", "bar"} {
+		data := map[string]interface{}{"Token": i, "User": strings.Repeat("x", i), "Name": name}
+
+		output := new(bytes.Buffer)
+		if err := fpf.ExecuteTemplateCached(cache, []Form{{ID: "a", Values: url.Values{name: {"v"}}}}, output, tmpl, data); err != nil {
+			t.Fatal(err)
+		}
+
+		want := fmt.Sprintf(`<form id="a"><input type="hidden" name="csrf" value="%d"/><p>Hello %s</p><input name="%s" value="v"/></form>`, i, data["User"], name)
+		if output.String() != want {
+			t.Errorf("ExecuteTemplateCached(%v):\nGot:\n%s\nExpected:\n%s", data, output.String(), want)
+		}
+	}
+	if cache.order.Len() != 1 {
+		t.Errorf("PlanCache: %d plans held for one layout, expected 1", cache.order.Len())
+	}
+
+	// Each layout of a key has a plan, and the least recently used plan is
+	// evicted
+	documents := []string{`<form id="a"><input name="foo"></form>`, `<form id="b"><input name="foo"></form>`, `<form id="a"><input name="bar"></form>`, `<p>other</p>`}
+	for _, document := range documents {
+		if _, err := cache.Plan("key", []byte(document)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(cache.plans["key"]) != 2 || cache.plans[tmpl] != nil {
+		t.Errorf("PlanCache: held %d plans of key, %d of template, expected 2 and 0", len(cache.plans["key"]), len(cache.plans[tmpl]))
+	}
+
+	for i, document := range documents[1:] {
+		var held bool
+		for _, e := range cache.plans["key"] {
+			if _, ok := e.Value.(*cachedPlan).plan.bind([]byte(document)); ok {
+				held = true
+			}
+		}
+		if held != (i > 0) {
+			t.Errorf("PlanCache: plan of %s held %v, expected %v", document, held, i > 0)
+		}
+	}
+}
+
+func BenchmarkExecutePlan(b *testing.B) {
+	document := largeDocument(1000)
+	forms := largeForms()
+	fpf := New()
+
+	plan, err := Compile(strings.NewReader(document))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(document)))
+	for i := 0; i < b.N; i++ {
+		if err := fpf.ExecutePlan(forms, io.Discard, plan); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPlanCache(b *testing.B) {
+	document := []byte(largeDocument(1000))
+	forms := largeForms()
+	fpf := New()
+	cache := &PlanCache{}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(document)))
+	for i := 0; i < b.N; i++ {
+		// A token differing each time
+		document := append([]byte(fmt.Sprintf(`<input type="hidden" name="token" value="%d" form="large">`, i)), document...)
+
+		plan, err := cache.Plan("large", document)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := fpf.ExecutePlan(forms, io.Discard, plan); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package fpf
+
+import (
+	"path"
+	"strings"
+
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+)
+
+// PopulationPolicy decides which elements are populated with values, so that
+// sensitive values aren't sent back to the user and values in the document,
+// such as CSRF tokens, aren't overwritten by those submitted.
+type PopulationPolicy struct {
+	// Names of elements that aren't populated, such as "card-number". Names
+	// can also be patterns, as used by path.Match, such as "*-cvv".
+	Exclude []string
+
+	// Names or patterns of elements that are left as they are in the
+	// document, including in Reset mode, such as "csrf-token".
+	Protect []string
+
+	// Whether elements with sensitive autocomplete tokens aren't populated.
+	// These are "off", "one-time-code" and credit card tokens, such as
+	// "cc-number" and "cc-csc". An element without an autocomplete attribute
+	// uses that of its form element.
+	Autocomplete bool
+}
+
+// excluded reports whether an element isn't populated under the policy.
+func (policy *PopulationPolicy) excluded(form *Form, n *html.Node) bool {
+	if policy == nil {
+		return false
+	}
+
+	attributes := attr.Attributes(n.Attr)
+	if matchName(policy.Exclude, attributes.Get("name")) {
+		return true
+	}
+	if !policy.Autocomplete {
+		return false
+	}
+
+	autocomplete := attributes.Attribute("autocomplete")
+	if autocomplete == nil && form.node != nil {
+		autocomplete = attr.Attributes(form.node.Attr).Attribute("autocomplete")
+	}
+	if autocomplete == nil {
+		return false
+	}
+
+	for _, token := range strings.Fields(strings.ToLower(autocomplete.Val)) {
+		if token == "off" || token == "one-time-code" || strings.HasPrefix(token, "cc-") {
+			return true
+		}
+	}
+	return false
+}
+
+// protected reports whether an element is left as it is under the policy.
+func (policy *PopulationPolicy) protected(n *html.Node) bool {
+	return policy != nil && matchName(policy.Protect, attr.Attributes(n.Attr).Get("name"))
+}
+
+// matchName reports whether a name is any of the names or patterns provided.
+func matchName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == name {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package fpf
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPopulationPolicy(t *testing.T) {
+	html := `<form id="a"><input name="name"><input name="card-number"><input name="card-cvv"><input name="items[0]"><input name="code" autocomplete="one-time-code"><input name="cc" autocomplete="billing cc-number"><input name="nick" autocomplete="nickname"><input type="hidden" name="csrf" value="token"></form><form id="b" autocomplete="off"><input name="name"><input name="other" autocomplete="on"></form>`
+	values := url.Values{"name": {"x"}, "card-number": {"x"}, "card-cvv": {"x"}, "items[0]": {"x"}, "code": {"x"}, "cc": {"x"}, "nick": {"x"}, "csrf": {"x"}, "other": {"x"}}
+
+	tests := []struct {
+		policy *PopulationPolicy
+		want   string
+	}{
+		{
+			nil,
+			`<form id="a"><input name="name" value="x"/><input name="card-number" value="x"/><input name="card-cvv" value="x"/><input name="items[0]" value="x"/><input name="code" autocomplete="one-time-code" value="x"/><input name="cc" autocomplete="billing cc-number" value="x"/><input name="nick" autocomplete="nickname" value="x"/><input type="hidden" name="csrf" value="x"/></form><form id="b" autocomplete="off"><input name="name" value="x"/><input name="other" autocomplete="on" value="x"/></form>`,
+		},
+		{
+			&PopulationPolicy{Exclude: []string{"card-number", "*-cvv", "items[0]"}, Protect: []string{"csrf"}, Autocomplete: true},
+			`<form id="a"><input name="name" value="x"/><input name="card-number"/><input name="card-cvv"/><input name="items[0]"/><input name="code" autocomplete="one-time-code"/><input name="cc" autocomplete="billing cc-number"/><input name="nick" autocomplete="nickname" value="x"/><input type="hidden" name="csrf" value="token"/></form><form id="b" autocomplete="off"><input name="name"/><input name="other" autocomplete="on" value="x"/></form>`,
+		},
+	}
+
+	for _, test := range tests {
+		fpf := New()
+		fpf.Fragment = true
+		fpf.Policy = test.policy
+
+		// The form's autocomplete attribute applies when streaming
+		executes := map[string]func(forms []Form, w io.Writer, r io.Reader) error{
+			"Execute":       fpf.Execute,
+			"ExecuteStream": fpf.ExecuteStream,
+			"ExecutePlan": func(forms []Form, w io.Writer, r io.Reader) error {
+				plan, err := Compile(r)
+				if err != nil {
+					return err
+				}
+				return fpf.ExecutePlan(forms, w, plan)
+			},
+		}
+
+		for name, execute := range executes {
+			output := new(bytes.Buffer)
+			forms := []Form{{ID: "a", Values: values}, {ID: "b", Values: values}}
+			if err := execute(forms, output, strings.NewReader(html)); err != nil {
+				t.Error(err)
+			}
+			if output.String() != test.want {
+				t.Errorf("%s(`%s`):\nGot:\n%s\nExpected:\n%s", name, html, output.String(), test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package fpf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/saracen/fpf/attr"
+)
+
+// UnmatchedKind is the kind of part of a form that matched nothing in the
+// document.
+type UnmatchedKind string
+
+const (
+	// A form ID that matched no form element or form element owner.
+	UnmatchedForm UnmatchedKind = "form"
+
+	// A value name that matched no form element.
+	UnmatchedValue UnmatchedKind = "value"
+
+	// An incident name that matched no form element, or an incident
+	// concerning the whole form of a form element that wasn't found.
+	UnmatchedIncident UnmatchedKind = "incident"
+
+	// A select value that matched no option of the select.
+	UnmatchedOption UnmatchedKind = "option"
+
+	// A radio button value that matched no radio button of the group.
+	UnmatchedRadio UnmatchedKind = "radio"
+)
+
+// Unmatched is a part of a provided form that matched nothing in the
+// document.
+type Unmatched struct {
+	Kind  UnmatchedKind
+	Form  string // The form ID
+	Name  string // The value or incident name
+	Value string // The option or radio button value
+}
+
+func (u Unmatched) String() string {
+	switch u.Kind {
+	case UnmatchedForm:
+		return fmt.Sprintf("form %q", u.Form)
+	case UnmatchedIncident:
+		if u.Name == "" {
+			return fmt.Sprintf("form %q: form incident", u.Form)
+		}
+		return fmt.Sprintf("form %q: incident name %q", u.Form, u.Name)
+	case UnmatchedOption, UnmatchedRadio:
+		return fmt.Sprintf("form %q: %s %q of %q", u.Form, u.Kind, u.Value, u.Name)
+	}
+	return fmt.Sprintf("form %q: %s %q", u.Form, u.Kind, u.Name)
+}
+
+// Report lists the parts of the provided forms that matched nothing in the
+// document. These are often caused by typos in templates or form values.
+//
+// In strict mode, a non-empty report is returned as the error of Execute.
+type Report struct {
+	Unmatched []Unmatched
+}
+
+func (r *Report) Error() string {
+	unmatched := make([]string, len(r.Unmatched))
+	for i, u := range r.Unmatched {
+		unmatched[i] = u.String()
+	}
+	return "fpf: unmatched " + strings.Join(unmatched, ", ")
+}
+
+func (r *Report) add(unmatched Unmatched) {
+	r.Unmatched = append(r.Unmatched, unmatched)
+}
+
+// check reports the form, values, select options and radio button values of a
+// traversed form that matched nothing in the document. It returns false if
+// the form itself matched nothing.
+func (p *processor) check(formId string) bool {
+	form := p.forms[formId]
+	if form.node == nil && len(form.inputs) == 0 {
+		p.report.add(Unmatched{Kind: UnmatchedForm, Form: formId})
+		return false
+	}
+
+	controls := make(map[string]bool)
+	options := make(map[string][]string)
+	radios := make(map[string][]string)
+	for _, input := range form.inputs {
+		attributes := attr.Attributes(input.Attr)
+		name := attributes.Get("name")
+		controls[name] = true
+
+		switch {
+		case input.Data == "select":
+			for _, option := range form.options[input] {
+				options[name] = append(options[name], optionValue(option))
+			}
+
+		case input.Data == "input" && strings.EqualFold(attributes.Get("type"), "radio"):
+			value := "on"
+			if attributes.Has("value") {
+				value = attributes.Get("value")
+			}
+			radios[name] = append(radios[name], value)
+		}
+	}
+
+	names := make([]string, 0, len(form.Values))
+	for name := range form.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !controls[name] {
+			p.report.add(Unmatched{Kind: UnmatchedValue, Form: formId, Name: name})
+			continue
+		}
+
+		for _, value := range form.Values[name] {
+			if values, ok := options[name]; ok && !p.AppendMissingOptions && !contains(values, value) {
+				p.report.add(Unmatched{Kind: UnmatchedOption, Form: formId, Name: name, Value: value})
+			}
+			if values, ok := radios[name]; ok && !contains(values, value) {
+				p.report.add(Unmatched{Kind: UnmatchedRadio, Form: formId, Name: name, Value: value})
+			}
+		}
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package fpf
+
+import (
+	"bytes"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormIncidents(t *testing.T) {
+	html := `<!DOCTYPE html><html><head></head><body><form id="login" action="/"><input type="text" name="username"/></form><input type="text" name="remember" form="settings"/></body></html>`
+	want := `<!DOCTYPE html><html><head></head><body><form id="login" action="/"><ul class="errors"><li>Your session has expired.</li></ul><input type="text" name="username" class="error"/><ul class="errors"><li>Unknown username.</li></ul></form><input type="text" name="remember" form="settings"/></body></html>`
+	forms := []Form{
+		{
+			ID: "login",
+			Incidents: []Incident{
+				{
+					Names:  nil,
+					Errors: []string{"Your session has expired."},
+				},
+				{
+					Names:  []string{"username", "usernme"},
+					Errors: []string{"Unknown username."},
+				},
+				{
+					Names:  []string{"password"},
+					Errors: []string{"Incorrect password."},
+				},
+			},
+		},
+		{
+			ID: "settings",
+			Incidents: []Incident{
+				{
+					Names:  nil,
+					Errors: []string{"Settings could not be saved."},
+				},
+			},
+		},
+	}
+
+	fpf := New()
+
+	output := new(bytes.Buffer)
+	report, err := fpf.ExecuteWithReport(forms, output, strings.NewReader(html))
+	if err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+
+	unmatched := []Unmatched{
+		{Kind: UnmatchedIncident, Form: "login", Name: "usernme"},
+		{Kind: UnmatchedIncident, Form: "login", Name: "password"},
+		{Kind: UnmatchedIncident, Form: "settings"},
+	}
+	if !reflect.DeepEqual(report.Unmatched, unmatched) {
+		t.Errorf("ExecuteWithReport(`%s`):\nGot:\n%v\nExpected:\n%v", html, report.Unmatched, unmatched)
+	}
+}
+
+func TestReport(t *testing.T) {
+	html := `<!DOCTYPE html><html><head></head><body><form id="order" action="/"><select name="size"><option value="s">Small</option><option>Large</option></select><input type="radio" name="colour" value="red"/><input type="radio" name="colour" value="blue"/><input type="checkbox" name="gift"/></form></body></html>`
+	forms := []Form{
+		{
+			ID: "order",
+			Values: url.Values{
+				"size":   []string{"Large", "xl"},
+				"colour": []string{"green"},
+				"gift":   []string{"on"},
+				"note":   []string{"Leave by the door"},
+			},
+		},
+		{
+			ID: "ordr",
+		},
+	}
+
+	unmatched := []Unmatched{
+		{Kind: UnmatchedRadio, Form: "order", Name: "colour", Value: "green"},
+		{Kind: UnmatchedValue, Form: "order", Name: "note"},
+		{Kind: UnmatchedOption, Form: "order", Name: "size", Value: "xl"},
+		{Kind: UnmatchedForm, Form: "ordr"},
+	}
+
+	fpf := New()
+
+	report, err := fpf.ExecuteWithReport(forms, new(bytes.Buffer), strings.NewReader(html))
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(report.Unmatched, unmatched) {
+		t.Errorf("ExecuteWithReport(`%s`):\nGot:\n%v\nExpected:\n%v", html, report.Unmatched, unmatched)
+	}
+
+	fpf.Strict = true
+
+	output := new(bytes.Buffer)
+	err = fpf.Execute(forms, output, strings.NewReader(html))
+
+	want := `fpf: unmatched form "order": radio "green" of "colour", form "order": value "note", form "order": option "xl" of "size", form "ordr"`
+	if err == nil || err.Error() != want {
+		t.Errorf("Execute(`%s`) in strict mode:\nGot error:\n%v\nExpected:\n%s", html, err, want)
+	}
+	if output.Len() > 0 {
+		t.Errorf("Execute(`%s`) in strict mode wrote output: %s", html, output.String())
+	}
+}
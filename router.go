@@ -0,0 +1,85 @@
+package fpf
+
+import (
+	"strings"
+
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+)
+
+// Route selects an incident insertion strategy for the elements it matches.
+// Empty fields match any element.
+type Route struct {
+	Element string // The element, such as "select"
+	Name    string // The element name, or a pattern as used by path.Match
+	Type    string // The input type, such as "radio"
+
+	// A data-fpf-* attribute the element has, such as "data-fpf-widget", and
+	// its value if not empty
+	Attribute string
+	Value     string
+
+	Inserter IncidentInserter
+}
+
+// match reports whether the route matches an element.
+func (r *Route) match(n *html.Node) bool {
+	attributes := attr.Attributes(n.Attr)
+
+	switch {
+	case r.Element != "" && r.Element != n.Data:
+		return false
+	case r.Name != "" && !matchName([]string{r.Name}, attributes.Get("name")):
+		return false
+	case r.Type != "" && (n.Data != "input" || !strings.EqualFold(r.Type, attributes.Get("type"))):
+		return false
+	}
+
+	if r.Attribute != "" {
+		if !strings.HasPrefix(r.Attribute, "data-fpf-") || !attributes.Has(r.Attribute) {
+			return false
+		}
+		if r.Value != "" && attributes.Get(r.Attribute) != r.Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RouterIncidentInserter inserts each incident using the strategy of the
+// first route matching the first element it concerns, allowing controls such
+// as text inputs, radio groups and custom widgets to have their error
+// messages placed differently.
+type RouterIncidentInserter struct {
+	Routes []Route
+
+	// The strategy used for incidents no route matches, and those concerning
+	// the whole form. Defaults to DefaultIncidentInserter.
+	Default IncidentInserter
+}
+
+func (i *RouterIncidentInserter) Insert(elements []LabelableElement, errors []string) error {
+	return i.InsertIncident(&Insertion{
+		Incident: Incident{Errors: errors},
+		Elements: elements,
+	})
+}
+
+func (i *RouterIncidentInserter) InsertIncident(insertion *Insertion) error {
+	inserter := i.Default
+	if inserter == nil {
+		inserter = DefaultIncidentInserter
+	}
+
+	if len(insertion.Elements) > 0 {
+		for _, route := range i.Routes {
+			if route.Inserter != nil && route.match(insertion.Elements[0].Element) {
+				inserter = route.Inserter
+				break
+			}
+		}
+	}
+
+	return insertIncident(inserter, insertion)
+}
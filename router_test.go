@@ -0,0 +1,94 @@
+package fpf
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestRouterIncidentInserter(t *testing.T) {
+	html := `<form id="a"><input name="email"><div><input type="radio" name="plan" value="a"><input type="radio" name="plan" value="b"></div><div><select name="day" data-fpf-widget="date"></select><select name="month"></select></div><input name="address.city"></form>`
+	want := `<form id="a"><input name="email" class="error"/><ul class="errors"><li>Invalid email.</li></ul><div><p class="radio-error">Choose a plan.</p><input type="radio" name="plan" value="a" class="error"/><input type="radio" name="plan" value="b" class="error"/></div><div><select name="day" data-fpf-widget="date" class="error"></select><select name="month" class="error"></select></div><span class="widget-error">Invalid date.</span><span class="address-error">Unknown city.</span><input name="address.city" class="error"/></form>`
+
+	inserter := func(tmpl string, location Location) *GenericIncidentInserter {
+		return &GenericIncidentInserter{
+			ErrorClass:                   "error",
+			SingleElementErrorLocation:   location,
+			MultipleElementErrorLocation: location,
+			Template:                     template.Must(template.New("").Parse(tmpl)),
+		}
+	}
+
+	router := &RouterIncidentInserter{
+		Routes: []Route{
+			{Type: "radio", Inserter: inserter(`<p class="radio-error">{{range .}}{{.}}{{end}}</p>`, FirstChild)},
+			{Attribute: "data-fpf-widget", Value: "date", Inserter: inserter(`<span class="widget-error">{{range .}}{{.}}{{end}}</span>`, After)},
+			{Element: "select", Inserter: inserter(`<span>Unused</span>`, After)},
+			{Name: "address.*", Inserter: inserter(`<span class="address-error">{{range .}}{{.}}{{end}}</span>`, Before)},
+		},
+	}
+
+	forms := []Form{
+		{
+			ID: "a",
+			Incidents: []Incident{
+				{Names: []string{"email"}, Errors: []string{"Invalid email."}},
+				{Names: []string{"plan"}, Errors: []string{"Choose a plan."}},
+				{Names: []string{"day", "month"}, Errors: []string{"Invalid date."}},
+				{Names: []string{"address.city"}, Errors: []string{"Unknown city."}},
+			},
+		},
+	}
+
+	fpf := New()
+	fpf.Fragment = true
+	fpf.IncidentInsertion = router
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
+
+func TestIncidentInserterPrecedence(t *testing.T) {
+	html := `<form id="a"><input name="foo"><input name="bar"></form><form id="b"><input name="foo"></form>`
+	want := `<form id="a"><input name="foo" class="form-error"/><p>form</p><input name="bar" class="incident-error"/><p>incident</p></form><form id="b"><input name="foo" class="error"/><ul class="errors"><li>b</li></ul></form>`
+
+	inserter := func(class, text string) *GenericIncidentInserter {
+		return &GenericIncidentInserter{
+			ErrorClass:                 class,
+			SingleElementErrorLocation: After,
+			Template:                   template.Must(template.New("").Parse(`<p>` + text + `</p>`)),
+		}
+	}
+
+	forms := []Form{
+		{
+			ID:                "a",
+			IncidentInsertion: inserter("form-error", "form"),
+			Incidents: []Incident{
+				{Names: []string{"foo"}, Errors: []string{"a"}},
+				{Names: []string{"bar"}, Errors: []string{"a"}, Inserter: inserter("incident-error", "incident")},
+			},
+		},
+		{
+			ID:        "b",
+			Incidents: []Incident{{Names: []string{"foo"}, Errors: []string{"b"}}},
+		},
+	}
+
+	fpf := New()
+	fpf.Fragment = true
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
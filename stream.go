@@ -0,0 +1,391 @@
+package fpf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"html/template"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// segmentKind is the kind of a segment of a scanned document.
+type segmentKind int
+
+const (
+	textSegment      segmentKind = iota // Anything not listed below
+	formStartSegment                    // The start tag of a form element
+	formEndSegment                      // The end tag of a form element
+	controlSegment                      // A form control and its content
+)
+
+// segment is a part of a scanned document.
+type segment struct {
+	kind segmentKind
+	form string // The ID of the form a form element or control belongs to
+	raw  []byte
+
+	// The attributes of a form element's start tag
+	attr []html.Attribute
+
+	// The number of tokens of raw and a hash of their layout, so that a
+	// plan can be applied to another document with the same layout
+	tokens int
+	layout [sha256.Size]byte
+
+	// The parsed control, as the children of a node, if it has been parsed
+	// in advance
+	nodes *html.Node
+}
+
+// controlElements are the elements that are scanned as form controls.
+var controlElements = map[string]bool{
+	"input":    true,
+	"textarea": true,
+	"select":   true,
+	"button":   true,
+	"output":   true,
+	"progress": true,
+	"meter":    true,
+}
+
+// maxTextSegment is the size at which text is returned as a segment.
+const maxTextSegment = 4096
+
+// rawTextElements are the elements whose content the tokenizer reads as text.
+// Text isn't split after their start tags, so that every segment starts in the
+// same tokenizer state.
+var rawTextElements = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+// scanner splits a document into segments using a tokenizer, so that the
+// document doesn't need to be parsed in its entirety.
+type scanner struct {
+	z *html.Tokenizer
+
+	form    *string // The ID of the open form element, nil if there isn't one
+	text    []byte
+	tokens  int // The number of tokens of text
+	pending []segment
+	err     error
+}
+
+func newScanner(r io.Reader) *scanner {
+	return &scanner{z: html.NewTokenizer(r)}
+}
+
+// next returns the next segment of the document, or io.EOF once the document
+// has been scanned.
+func (s *scanner) next() (segment, error) {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			if len(s.text) == 0 {
+				return segment{}, s.err
+			}
+			s.flush()
+			break
+		}
+		s.scan()
+	}
+
+	seg := s.pending[0]
+	s.pending = s.pending[1:]
+
+	return seg, nil
+}
+
+// scan reads the next token, adding it to the pending text or segments.
+func (s *scanner) scan() {
+	tt := s.z.Next()
+	if tt == html.ErrorToken {
+		s.err = s.z.Err()
+		return
+	}
+
+	// Reading the tag name and attributes lower-cases them in place, so the
+	// raw token is kept first
+	mark, count := len(s.text), s.tokens
+	s.text = append(s.text, s.z.Raw()...)
+	s.tokens++
+
+	split := true
+	switch tt {
+	case html.StartTagToken, html.SelfClosingTagToken:
+		name, hasAttr := s.z.TagName()
+		split = tt != html.StartTagToken || !rawTextElements[string(name)]
+		if string(name) == "form" {
+			if s.form != nil {
+				break
+			}
+
+			var id string
+			var attributes []html.Attribute
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = s.z.TagAttr()
+				if string(key) == "id" {
+					id = string(val)
+				}
+				attributes = append(attributes, html.Attribute{Key: string(key), Val: string(val)})
+			}
+			s.form = &id
+
+			s.emit(mark, count, segment{kind: formStartSegment, form: id, attr: attributes})
+			return
+		}
+
+		if !controlElements[string(name)] {
+			break
+		}
+		element := string(name)
+
+		// Controls belong to the form of their form attribute, otherwise
+		// the open form element
+		var formId *string
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = s.z.TagAttr()
+			if string(key) == "form" {
+				id := string(val)
+				formId = &id
+			}
+		}
+		if formId == nil {
+			formId = s.form
+		}
+		if formId == nil {
+			break
+		}
+
+		if element != "input" && tt == html.StartTagToken {
+			s.collect(element)
+		}
+		s.emit(mark, count, segment{kind: controlSegment, form: *formId})
+		return
+
+	case html.EndTagToken:
+		if name, _ := s.z.TagName(); string(name) == "form" && s.form != nil {
+			id := *s.form
+			s.form = nil
+
+			s.emit(mark, count, segment{kind: formEndSegment, form: id})
+			return
+		}
+	}
+
+	if len(s.text) >= maxTextSegment && split {
+		s.flush()
+	}
+}
+
+// collect adds the tokens of an element's content and its end tag to the
+// pending text.
+func (s *scanner) collect(element string) {
+	for depth := 1; depth > 0; {
+		tt := s.z.Next()
+		if tt == html.ErrorToken {
+			s.err = s.z.Err()
+			return
+		}
+		s.text = append(s.text, s.z.Raw()...)
+		s.tokens++
+
+		switch tt {
+		case html.StartTagToken:
+			if name, _ := s.z.TagName(); string(name) == element {
+				depth++
+			}
+		case html.EndTagToken:
+			if name, _ := s.z.TagName(); string(name) == element {
+				depth--
+			}
+		}
+	}
+}
+
+// emit adds the pending text from mark onwards, the tokens after the first
+// count, as the raw content of seg, and the text before it as a text segment.
+func (s *scanner) emit(mark, count int, seg segment) {
+	seg.raw = append([]byte(nil), s.text[mark:]...)
+	seg.tokens = s.tokens - count
+	s.text, s.tokens = s.text[:mark], count
+	s.flush()
+
+	s.pending = append(s.pending, seg)
+}
+
+// flush adds any pending text as a text segment.
+func (s *scanner) flush() {
+	if len(s.text) == 0 {
+		return
+	}
+
+	s.pending = append(s.pending, segment{kind: textSegment, raw: s.text, tokens: s.tokens})
+	s.text, s.tokens = nil, 0
+}
+
+// stream filters the segments returned by next and writes the output to w.
+//
+// Forms that require incident insertion are buffered in their entirety and
+// filtered as a fragment, so that incidents can be inserted in relation to
+// the elements around them. Controls of any other forms are populated one at
+// a time, and everything else is written unmodified.
+func (p *processor) stream(next func() (segment, error), w io.Writer) error {
+	for {
+		seg, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		form, ok := p.forms[seg.form]
+		if ok && seg.kind == formStartSegment && form.start == nil {
+			form.start = seg.attr
+		}
+
+		switch {
+		case ok && seg.kind == formStartSegment && (len(form.Incidents) > 0 || (p.Validate && form.submitted != nil)):
+			raw := append([]byte(nil), seg.raw...)
+			for seg.kind != formEndSegment {
+				seg, err = next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				raw = append(raw, seg.raw...)
+			}
+			err = p.filterForm(raw, w)
+
+		case ok && seg.kind == controlSegment:
+			err = p.filterControl(seg, w)
+
+		default:
+			_, err = w.Write(seg.raw)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// filterForm filters a form element and its content.
+func (p *processor) filterForm(raw []byte, w io.Writer) error {
+	defer p.reset()
+
+	document, err := parseFragment(bytes.NewReader(raw), nil)
+	if err != nil {
+		return err
+	}
+
+	p.traverse(document, formContext{})
+	p.associateLabels()
+	for _, formId := range p.order {
+		if form := p.forms[formId]; form.node == nil && len(form.inputs) == 0 {
+			continue
+		}
+		if err = p.processForm(formId); err != nil {
+			return err
+		}
+	}
+
+	return renderChildren(w, document)
+}
+
+// filterControl populates a form control belonging to a form.
+func (p *processor) filterControl(seg segment, w io.Writer) error {
+	defer p.reset()
+
+	document := seg.nodes
+	if document == nil {
+		var err error
+		if document, err = parseFragment(bytes.NewReader(seg.raw), nil); err != nil {
+			return err
+		}
+	} else {
+		document = cloneNode(document)
+	}
+
+	// Controls are traversed in the context of their form's start tag, if it
+	// has been read, so that its attributes, such as autocomplete, apply
+	formNode := &html.Node{
+		Type: html.ElementNode,
+		Data: "form",
+		Attr: []html.Attribute{{Key: "id", Val: seg.form}},
+	}
+	if form := p.forms[seg.form]; form.start != nil {
+		formNode.Attr = form.start
+	}
+
+	p.traverse(document, formContext{Form: formNode})
+	p.forms[seg.form].node = formNode
+	p.generateOptions(seg.form)
+	p.applyDefaults(seg.form)
+	if err := p.populate(seg.form); err != nil {
+		return err
+	}
+
+	return renderChildren(w, document)
+}
+
+// reset forgets the elements traversed, but not the position of elements
+// sharing a name, so that subsequent parts of a document can be traversed.
+func (p *processor) reset() {
+	p.labels = nil
+	p.datalists = make(map[string]*html.Node)
+	for _, form := range p.forms {
+		form.inputs = nil
+		form.labels = make(map[*html.Node][]*html.Node)
+		form.options = make(map[*html.Node][]*html.Node)
+		form.index = make(map[*html.Node]int)
+		form.node = nil
+		form.slots = nil
+	}
+}
+
+// ExecuteStream is like Execute, but filters the input as it is read rather
+// than parsing it in its entirety, which uses considerably less memory for
+// large documents.
+//
+// Form controls are populated one at a time and the rest of the document is
+// written unmodified. Forms with incidents, or all submitted forms if
+// Validate is enabled, are buffered and filtered in their entirety so that
+// incidents can be inserted in relation to the elements around them. Incidents concerning
+// controls outside of their form element, associated by a form attribute, are
+// not inserted.
+//
+// Datalists are only populated with suggestions if they are within a buffered
+// form. No report of unmatched parts of the forms is made, and Strict has no
+// effect.
+func (fpf *FormPopulationFilter) ExecuteStream(forms []Form, w io.Writer, r io.Reader) error {
+	return newProcessor(fpf, forms).stream(newScanner(r).next, w)
+}
+
+// ExecuteTemplateStream is like ExecuteTemplate, but filters the template
+// output as it is produced rather than buffering it. See ExecuteStream.
+//
+// If executing the template fails, output may have already been written.
+func (fpf *FormPopulationFilter) ExecuteTemplateStream(forms []Form, w io.Writer, t *template.Template, data interface{}) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(t.Execute(pw, data))
+	}()
+
+	err := fpf.ExecuteStream(forms, w, pr)
+	pr.CloseWithError(io.ErrClosedPipe)
+
+	return err
+}
@@ -0,0 +1,155 @@
+package fpf
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExecuteStream(t *testing.T) {
+	tests := []struct {
+		html  string
+		want  string
+		forms []Form
+	}{
+		// Markup outside of form controls is written unmodified
+		{
+			`<!DOCTYPE html><HTML><Body><p class=x>Hello &amp; <b>welcome</b><form id="a"><input name="foo"><input name=bar type="checkbox" value="1"></form></Body></HTML>`,
+			`<!DOCTYPE html><HTML><Body><p class=x>Hello &amp; <b>welcome</b><form id="a"><input name="foo" value="x"/><input name="bar" type="checkbox" value="1" checked="checked"/></form></Body></HTML>`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"x"}, "bar": {"1"}}}},
+		},
+		// Controls with content
+		{
+			`<form id="a"><textarea name="t">old</textarea><select name="s"><option value="1">1</option><option value="2" selected>2</option></select><button name="b">Go</button></form>`,
+			`<form id="a"><textarea name="t">new</textarea><select name="s"><option value="1" selected="selected">1</option><option value="2">2</option></select><button name="b">Go</button></form>`,
+			[]Form{{ID: "a", Values: url.Values{"t": {"new"}, "s": {"1"}}}},
+		},
+		// Repeated names across separate controls
+		{
+			`<form id="a"><input name="foo"><p>and</p><input name="foo"></form>`,
+			`<form id="a"><input name="foo" value="1"/><p>and</p><input name="foo" value="2"/></form>`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"1", "2"}}}},
+		},
+		// Controls associated by a form attribute
+		{
+			`<form id="a"></form><input name="foo" form="a"><input name="foo">`,
+			`<form id="a"></form><input name="foo" form="a" value="x"/><input name="foo">`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"x"}}}},
+		},
+		// Forms that aren't provided are written unmodified
+		{
+			`<form id="b"><input name="foo"></form>`,
+			`<form id="b"><input name="foo"></form>`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"x"}}}},
+		},
+		// Forms with incidents are filtered in their entirety
+		{
+			`<p>Before</p><form id="a"><label for="foo">Foo</label><input id="foo" name="foo"></form><p>After</p>`,
+			`<p>Before</p><form id="a"><label for="foo" class="error">Foo</label><input id="foo" name="foo" value="x" class="error"/><ul class="errors"><li>Invalid</li></ul></form><p>After</p>`,
+			[]Form{{ID: "a", Values: url.Values{"foo": {"x"}}, Incidents: []Incident{{Names: []string{"foo"}, Errors: []string{"Invalid"}}}}},
+		},
+	}
+
+	fpf := New()
+	for _, test := range tests {
+		output := new(bytes.Buffer)
+		if err := fpf.ExecuteStream(test.forms, output, strings.NewReader(test.html)); err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.want {
+			t.Errorf("ExecuteStream(`%s`):\nGot:\n%s\nExpected:\n%s", test.html, output.String(), test.want)
+		}
+	}
+}
+
+func TestExecuteStreamLarge(t *testing.T) {
+	document := largeDocument(1000)
+
+	fpf := New()
+	output := new(bytes.Buffer)
+	if err := fpf.ExecuteStream(largeForms(), output, strings.NewReader(document)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(output.String(), document[:maxTextSegment*2]) {
+		t.Errorf("ExecuteStream: markup before the form was modified")
+	}
+	if !strings.Contains(output.String(), `<input type="text" name="field-19" value="value-19"/>`) {
+		t.Errorf("ExecuteStream: form was not populated")
+	}
+}
+
+func TestExecuteTemplateStream(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`<form id="a"><input name="foo"></form>{{.}}`))
+	want := `<form id="a"><input name="foo" value="x"/></form>&lt;done&gt;`
+
+	fpf := New()
+	output := new(bytes.Buffer)
+	if err := fpf.ExecuteTemplateStream([]Form{{ID: "a", Values: url.Values{"foo": {"x"}}}}, output, tmpl, "<done>"); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("ExecuteTemplateStream:\nGot:\n%s\nExpected:\n%s", output.String(), want)
+	}
+
+	tmpl = template.Must(template.New("").Parse(`<form id="a">{{.Missing}}</form>`))
+	if err := fpf.ExecuteTemplateStream(nil, io.Discard, tmpl, 0); err == nil {
+		t.Errorf("ExecuteTemplateStream: expected template error")
+	}
+}
+
+// largeDocument returns a document with many rows of a table preceding a form.
+func largeDocument(rows int) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><head><title>Large</title></head><body><table>`)
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&b, `<tr><td class="id">%d</td><td><a href="/items/%d">Item %d</a></td><td>Some description of the item</td></tr>`, i, i, i)
+	}
+	b.WriteString(`</table><form id="large" method="post">`)
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&b, `<label for="field-%d">Field %d</label><input type="text" name="field-%d">`, i, i, i)
+	}
+	b.WriteString(`</form></body></html>`)
+
+	return b.String()
+}
+
+func largeForms() []Form {
+	values := make(url.Values)
+	for i := 0; i < 20; i++ {
+		values.Set(fmt.Sprintf("field-%d", i), fmt.Sprintf("value-%d", i))
+	}
+	return []Form{{ID: "large", Values: values}}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	document := largeDocument(1000)
+	forms := largeForms()
+	fpf := New()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(document)))
+	for i := 0; i < b.N; i++ {
+		if err := fpf.Execute(forms, io.Discard, strings.NewReader(document)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecuteStream(b *testing.B) {
+	document := largeDocument(1000)
+	forms := largeForms()
+	fpf := New()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(document)))
+	for i := 0; i < b.N; i++ {
+		if err := fpf.ExecuteStream(forms, io.Discard, strings.NewReader(document)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
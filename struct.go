@@ -0,0 +1,212 @@
+package fpf
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// FormFromStruct returns a Form with the provided ID whose values are taken
+// from the exported fields of v, which must be a struct or a pointer to one.
+//
+// A field's name is taken from its "form" struct tag, or is the field name if
+// it has no tag. Fields with the tag "-" are skipped. Values are formatted as
+// follows:
+//
+//   - Booleans are "on", the value of a checkbox without a value attribute, if
+//     true and omitted if false, so that an unchecked checkbox remains
+//     unchecked. The checked option sets the value of true booleans for
+//     checkboxes with a value attribute, such as form:"subscribed,checked=1".
+//
+//   - time.Time is formatted as RFC 3339, and reformatted for the type of the
+//     date or time input it populates. Zero times are omitted.
+//
+//   - Types implementing encoding.TextMarshaler are formatted using
+//     MarshalText.
+//
+//   - Slices and arrays provide a value for each of their elements.
+//
+//   - Nested structs have their fields named with a dot, e.g. "address.city",
+//     slices of structs are indexed with brackets, e.g. "items[0].name", and
+//     maps with string keys are keyed with brackets, e.g. "meta[key]".
+//     Embedded structs without a tag have their fields promoted.
+//
+// Nil pointers and interfaces are omitted.
+func FormFromStruct(id string, v interface{}) (Form, error) {
+	form := Form{ID: id, Values: make(url.Values)}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return form, fmt.Errorf("fpf: FormFromStruct of non-struct type %T", v)
+	}
+
+	if err := encodeStruct(form.Values, "", rv); err != nil {
+		return form, err
+	}
+
+	return form, nil
+}
+
+// encodeStruct adds the values of a struct's fields to values, with names
+// prefixed by prefix.
+func encodeStruct(values url.Values, prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+
+		name, option := tag, ""
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			name, option = tag[:comma], tag[comma+1:]
+		}
+
+		fv := rv.Field(i)
+		if field.Anonymous && name == "" {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+				if err := encodeStruct(values, prefix, fv); err != nil {
+					return err
+				}
+				continue
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if err := encodeValue(values, name, option, fv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeValue adds the formatted value of rv to values.
+func encodeValue(values url.Values, name, option string, rv reflect.Value) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Type() == timeType {
+		if t := rv.Interface().(time.Time); !t.IsZero() {
+			values.Add(name, t.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	if rv.Type().Implements(textMarshalerType) {
+		text, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		values.Add(name, string(text))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		values.Add(name, rv.String())
+
+	case reflect.Bool:
+		if rv.Bool() {
+			values.Add(name, checkedValue(option))
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		values.Add(name, strconv.FormatInt(rv.Int(), 10))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		values.Add(name, strconv.FormatUint(rv.Uint(), 10))
+
+	case reflect.Float32, reflect.Float64:
+		values.Add(name, strconv.FormatFloat(rv.Float(), 'f', -1, rv.Type().Bits()))
+
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.Slice {
+			values.Add(name, string(rv.Bytes()))
+			return nil
+		}
+
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+				elem = elem.Elem()
+			}
+
+			var err error
+			if elem.Kind() == reflect.Struct && elem.Type() != timeType && !elem.Type().Implements(textMarshalerType) {
+				err = encodeStruct(values, name+"["+strconv.Itoa(i)+"]", elem)
+			} else {
+				err = encodeValue(values, name, option, elem)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("fpf: FormFromStruct of unsupported map key type %s for %q", rv.Type().Key(), name)
+		}
+
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			if err := encodeValue(values, name+"["+key.String()+"]", option, rv.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		return encodeStruct(values, name, rv)
+
+	default:
+		return fmt.Errorf("fpf: FormFromStruct of unsupported type %s for %q", rv.Type(), name)
+	}
+
+	return nil
+}
+
+// checkedValue returns the value of true booleans from the options of a
+// field's tag.
+func checkedValue(options string) string {
+	for _, option := range strings.Split(options, ",") {
+		if value, ok := strings.CutPrefix(option, "checked="); ok {
+			return value
+		}
+	}
+	return "on"
+}
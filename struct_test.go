@@ -0,0 +1,120 @@
+package fpf
+
+import (
+	"bytes"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormFromStruct(t *testing.T) {
+	type Address struct {
+		Street string `form:"street"`
+		City   string `form:"city"`
+	}
+	type Item struct {
+		Name     string  `form:"name"`
+		Quantity uint    `form:"qty"`
+		Price    float64 `form:"price"`
+	}
+	type Audit struct {
+		Created time.Time `form:"created"`
+	}
+
+	birthday := time.Date(1990, time.April, 2, 0, 0, 0, 0, time.UTC)
+	nickname := "sara"
+
+	v := struct {
+		Audit
+		Name       string            `form:"name"`
+		Nickname   *string           `form:"nickname"`
+		Email      *string           `form:"email"`
+		Age        int               `form:"age"`
+		Subscribed bool              `form:"subscribed"`
+		Terms      bool              `form:"terms,checked=1"`
+		Admin      bool              `form:"admin,checked=1"`
+		Birthday   time.Time         `form:"birthday"`
+		Reminder   time.Time         `form:"reminder"`
+		Week       time.Time         `form:"week"`
+		IP         net.IP            `form:"ip"`
+		Tags       []string          `form:"tags"`
+		Address    Address           `form:"address"`
+		Items      []Item            `form:"items"`
+		Meta       map[string]string `form:"meta"`
+		Ignored    string            `form:"-"`
+		Untagged   string
+		unexported string
+	}{
+		Name:       "Arran",
+		Nickname:   &nickname,
+		Age:        27,
+		Subscribed: true,
+		Terms:      true,
+		Birthday:   birthday,
+		Reminder:   time.Date(2017, time.May, 1, 9, 30, 0, 0, time.FixedZone("", 3600)),
+		Week:       time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+		IP:         net.IPv4(127, 0, 0, 1),
+		Tags:       []string{"a", "b"},
+		Address:    Address{"1 Main Street", "London"},
+		Items:      []Item{{"Tea", 2, 1.5}},
+		Meta:       map[string]string{"b": "2", "a": "1"},
+		Ignored:    "ignored",
+		Untagged:   "untagged",
+		unexported: "unexported",
+	}
+
+	want := Form{
+		ID: "profile",
+		Values: url.Values{
+			"name":           {"Arran"},
+			"nickname":       {"sara"},
+			"age":            {"27"},
+			"subscribed":     {"on"},
+			"terms":          {"1"},
+			"birthday":       {"1990-04-02T00:00:00Z"},
+			"reminder":       {"2017-05-01T09:30:00+01:00"},
+			"week":           {"2017-01-01T00:00:00Z"},
+			"ip":             {"127.0.0.1"},
+			"tags":           {"a", "b"},
+			"address.street": {"1 Main Street"},
+			"address.city":   {"London"},
+			"items[0].name":  {"Tea"},
+			"items[0].qty":   {"2"},
+			"items[0].price": {"1.5"},
+			"meta[a]":        {"1"},
+			"meta[b]":        {"2"},
+			"Untagged":       {"untagged"},
+		},
+	}
+
+	got, err := FormFromStruct("profile", &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FormFromStruct():\nGot:\n%v\nExpected:\n%v", got.Values, want.Values)
+	}
+
+	html := `<form id="profile"><input type="checkbox" name="subscribed"><input type="checkbox" name="terms" value="1"><input type="checkbox" name="admin" value="1"><input type="date" name="birthday"><input type="datetime-local" name="reminder"><input type="week" name="week"></form>`
+	populated := `<form id="profile"><input type="checkbox" name="subscribed" checked="checked"/><input type="checkbox" name="terms" value="1" checked="checked"/><input type="checkbox" name="admin" value="1"/><input type="date" name="birthday" value="1990-04-02"/><input type="datetime-local" name="reminder" value="2017-05-01T09:30"/><input type="week" name="week" value="2016-W52"/></form>`
+
+	fpf := New()
+	fpf.Fragment = true
+	output := new(bytes.Buffer)
+	if err := fpf.Execute([]Form{got}, output, strings.NewReader(html)); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != populated {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), populated)
+	}
+
+	if _, err := FormFromStruct("", "string"); err == nil {
+		t.Error("FormFromStruct() of non-struct type: expected error")
+	}
+	if _, err := FormFromStruct("", struct{ C chan int }{}); err == nil {
+		t.Error("FormFromStruct() of unsupported field type: expected error")
+	}
+}
@@ -0,0 +1,123 @@
+package fpf
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultErrorSummaryTemplate is the template used by an ErrorSummary if no
+// other template is provided.
+var DefaultErrorSummaryTemplate = template.Must(template.New("summary").Parse(`<div class="error-summary"><h2 class="error-summary-title">There is a problem</h2><ul class="error-summary-list">{{ range . }}{{ $id := .ID }}{{ range .Errors }}<li>{{ if $id }}<a href="#{{ $id }}">{{ . }}</a>{{ else }}{{ . }}{{ end }}</li>{{ end }}{{ end }}</ul></div>`))
+
+// ErrorSummary inserts a summary of every error incident of a form at a
+// location relative to the form element, with links to the elements
+// concerned. Incidents of other severities are left out.
+type ErrorSummary struct {
+	// The location to insert the summary, relative to the form element
+	Location Location
+
+	// Whether the summary is given tabindex="-1" so that it can be focused
+	Focus bool
+
+	// The summary template that will be inserted. It is executed with a slice
+	// of SummaryItem. Defaults to DefaultErrorSummaryTemplate.
+	Template *template.Template
+}
+
+// SummaryItem is an incident listed in an error summary.
+type SummaryItem struct {
+	// The ID of the first element the incident concerns. Elements without an
+	// ID are given one derived from their name. Empty if the incident
+	// concerns no element.
+	ID string
+
+	// The label text of the first element the incident concerns
+	Label string
+
+	Names  []string
+	Errors []string
+}
+
+// summarize inserts an error summary for a form's incidents.
+func (p *processor) summarize(formId string, incidents []Incident) error {
+	form := p.forms[formId]
+	if form.node == nil {
+		return nil
+	}
+
+	var items []SummaryItem
+	for _, incident := range incidents {
+		if incident.severity() != SeverityError {
+			continue
+		}
+
+		item := SummaryItem{
+			Names:  incident.Names,
+			Errors: incident.texts(),
+		}
+
+		if elements := p.elements(formId, incident); len(elements) > 0 {
+			element := elements[0].Element
+
+			item.ID = attr.Attributes(element.Attr).Get("id")
+			if item.ID == "" {
+				name := attr.Attributes(element.Attr).Get("name")
+				item.ID = uniqueID(element, strings.Join(strings.Fields(name), "-"))
+				setAttribute(element, "id", item.ID)
+			}
+
+			item.Label = fieldLabel(elements[0])
+		}
+
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	tmpl := p.Summary.Template
+	if tmpl == nil {
+		tmpl = DefaultErrorSummaryTemplate
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := tmpl.Execute(buffer, items); err != nil {
+		return err
+	}
+
+	nodes, err := html.ParseFragment(buffer, &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	location := p.Summary.Location
+	if location == "" {
+		location = FirstChild
+	}
+	location = insertLocation(form.node, location)
+
+	if len(nodes) > 0 && nodes[0].Type == html.ElementNode && p.Summary.Focus {
+		setAttribute(nodes[0], "tabindex", "-1")
+	}
+
+	for i := range nodes {
+		// Nodes inserted after or as the first child of the form are
+		// inserted in reverse to retain their order
+		n := nodes[i]
+		if location == After || location == FirstChild {
+			n = nodes[len(nodes)-1-i]
+		}
+		insertNode(n, form.node, location)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package fpf
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestErrorSummary(t *testing.T) {
+	html := `<!DOCTYPE html><html><head></head><body><form action="/"><label for="email">Email</label><input id="email" type="email" name="email"/><input type="text" name="name"/></form></body></html>`
+	forms := []Form{
+		{
+			Values: url.Values{"name": []string{"bar"}},
+			Incidents: []Incident{
+				{
+					Names:  []string{"email"},
+					Errors: []string{"Enter an email address."},
+				},
+				{
+					Names:  []string{"name"},
+					Errors: []string{"Enter your full name.", "Enter a name without numbers."},
+				},
+			},
+		},
+	}
+
+	wants := map[Location]string{
+		FirstChild: `<!DOCTYPE html><html><head></head><body><form action="/"><div class="error-summary" tabindex="-1"><h2 class="error-summary-title">There is a problem</h2><ul class="error-summary-list"><li><a href="#email">Enter an email address.</a></li><li><a href="#name">Enter your full name.</a></li><li><a href="#name">Enter a name without numbers.</a></li></ul></div><label for="email" class="error">Email</label><input id="email" type="email" name="email" class="error"/><ul class="errors"><li>Enter an email address.</li></ul><input type="text" name="name" value="bar" class="error" id="name"/><ul class="errors"><li>Enter your full name.</li><li>Enter a name without numbers.</li></ul></form></body></html>`,
+		Before:     `<!DOCTYPE html><html><head></head><body><div class="error-summary" tabindex="-1"><h2 class="error-summary-title">There is a problem</h2><ul class="error-summary-list"><li><a href="#email">Enter an email address.</a></li><li><a href="#name">Enter your full name.</a></li><li><a href="#name">Enter a name without numbers.</a></li></ul></div><form action="/"><label for="email" class="error">Email</label><input id="email" type="email" name="email" class="error"/><ul class="errors"><li>Enter an email address.</li></ul><input type="text" name="name" value="bar" class="error" id="name"/><ul class="errors"><li>Enter your full name.</li><li>Enter a name without numbers.</li></ul></form></body></html>`,
+	}
+
+	for location, want := range wants {
+		fpf := New()
+		fpf.Summary = &ErrorSummary{Location: location, Focus: true}
+
+		output := new(bytes.Buffer)
+		if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+			t.Error(err)
+		}
+		if output.String() != want {
+			t.Errorf("%s, Execute(`%s`):\nGot:\n%s\nExpected:\n%s", location, html, output.String(), want)
+		}
+	}
+}
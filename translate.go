@@ -0,0 +1,171 @@
+package fpf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Translator resolves the text of structured messages in a locale, such as
+// "en-GB". It reports false if it has no translation of the message.
+type Translator interface {
+	Translate(locale string, message Message) (string, bool)
+}
+
+// TranslatorFunc is an adapter to allow the use of ordinary functions as a
+// Translator.
+type TranslatorFunc func(locale string, message Message) (string, bool)
+
+// Translate calls f(locale, message).
+func (f TranslatorFunc) Translate(locale string, message Message) (string, bool) {
+	return f(locale, message)
+}
+
+// Translation is the text of a message in a locale. Message parameters are
+// substituted for placeholders in the text, such as "{max}".
+type Translation struct {
+	Text string
+
+	// The text used instead of Text if the parameter named Count is one, or
+	// in French, zero or one
+	One   string
+	Count string
+}
+
+// Catalog is a Translator of messages by locale and message code. Messages
+// of a locale with a region, such as "en-GB", that the catalog has no
+// translation of in that locale use the translation of its language, "en".
+type Catalog map[string]map[string]Translation
+
+// Translate returns the translation of a message in a locale.
+func (c Catalog) Translate(locale string, message Message) (string, bool) {
+	locale = strings.ToLower(strings.Replace(locale, "_", "-", -1))
+
+	translation, ok := c[locale][message.Code]
+	if !ok {
+		if dash := strings.IndexByte(locale, '-'); dash >= 0 {
+			locale = locale[:dash]
+			translation, ok = c[locale][message.Code]
+		}
+	}
+	if !ok || message.Code == "" {
+		return "", false
+	}
+
+	text := translation.Text
+	if translation.One != "" && one(locale, message.Params[translation.Count]) {
+		text = translation.One
+	}
+
+	for key, value := range message.Params {
+		text = strings.Replace(text, "{"+key+"}", fmt.Sprint(value), -1)
+	}
+
+	return text, true
+}
+
+// one reports whether a count takes the singular form in a language.
+func one(language string, count interface{}) bool {
+	n, err := strconv.ParseFloat(fmt.Sprint(count), 64)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(language, "fr") {
+		return n >= 0 && n < 2
+	}
+	return n == 1
+}
+
+// DefaultCatalog is a catalog of the messages of constraint validation in
+// English, French and German.
+var DefaultCatalog = Catalog{
+	"en": {
+		CodeValueMissing:      {Text: "Please fill out this field."},
+		CodeBadInput:          {Text: "Please enter a valid value."},
+		CodeTypeMismatchEmail: {Text: "Please enter an email address."},
+		CodeTypeMismatchURL:   {Text: "Please enter a URL."},
+		CodePatternMismatch:   {Text: "Please match the requested format."},
+		CodeTooLong:           {Text: "Please use no more than {max} characters.", One: "Please use no more than {max} character.", Count: "max"},
+		CodeTooShort:          {Text: "Please use at least {min} characters.", One: "Please use at least {min} character.", Count: "min"},
+		CodeRangeUnderflow:    {Text: "Please select a value that is no less than {min}."},
+		CodeRangeOverflow:     {Text: "Please select a value that is no more than {max}."},
+		CodeStepMismatch:      {Text: "Please select a value that is in steps of {step}."},
+	},
+	"fr": {
+		CodeValueMissing:      {Text: "Veuillez renseigner ce champ."},
+		CodeBadInput:          {Text: "Veuillez saisir une valeur valide."},
+		CodeTypeMismatchEmail: {Text: "Veuillez saisir une adresse électronique."},
+		CodeTypeMismatchURL:   {Text: "Veuillez saisir une URL."},
+		CodePatternMismatch:   {Text: "Veuillez respecter le format requis."},
+		CodeTooLong:           {Text: "Veuillez utiliser au plus {max} caractères.", One: "Veuillez utiliser au plus {max} caractère.", Count: "max"},
+		CodeTooShort:          {Text: "Veuillez utiliser au moins {min} caractères.", One: "Veuillez utiliser au moins {min} caractère.", Count: "min"},
+		CodeRangeUnderflow:    {Text: "Veuillez sélectionner une valeur supérieure ou égale à {min}."},
+		CodeRangeOverflow:     {Text: "Veuillez sélectionner une valeur inférieure ou égale à {max}."},
+		CodeStepMismatch:      {Text: "Veuillez sélectionner une valeur par pas de {step}."},
+	},
+	"de": {
+		CodeValueMissing:      {Text: "Bitte füllen Sie dieses Feld aus."},
+		CodeBadInput:          {Text: "Bitte geben Sie einen gültigen Wert ein."},
+		CodeTypeMismatchEmail: {Text: "Bitte geben Sie eine E-Mail-Adresse ein."},
+		CodeTypeMismatchURL:   {Text: "Bitte geben Sie eine URL ein."},
+		CodePatternMismatch:   {Text: "Bitte halten Sie sich an das vorgegebene Format."},
+		CodeTooLong:           {Text: "Bitte verwenden Sie höchstens {max} Zeichen."},
+		CodeTooShort:          {Text: "Bitte verwenden Sie mindestens {min} Zeichen."},
+		CodeRangeUnderflow:    {Text: "Bitte wählen Sie einen Wert, der nicht kleiner als {min} ist."},
+		CodeRangeOverflow:     {Text: "Bitte wählen Sie einen Wert, der nicht größer als {max} ist."},
+		CodeStepMismatch:      {Text: "Bitte wählen Sie einen Wert in Schritten von {step}."},
+	},
+}
+
+// translate returns incidents with the text of their structured messages
+// resolved in the locale of their form.
+func (p *processor) translate(formId string, incidents []Incident) []Incident {
+	if p.Translator == nil {
+		return incidents
+	}
+	locale := p.forms[formId].Locale
+
+	translated := make([]Incident, len(incidents))
+	for i, incident := range incidents {
+		messages := make([]Message, len(incident.Messages))
+		for j, message := range incident.Messages {
+			if text, ok := p.Translator.Translate(locale, message); ok {
+				message.Text = text
+			}
+			messages[j] = message
+		}
+
+		incident.Messages = messages
+		translated[i] = incident
+	}
+
+	return translated
+}
+
+// acceptLanguage returns the most preferred language of an Accept-Language
+// header, or an empty string if there isn't one.
+func acceptLanguage(header string) string {
+	var language string
+	preference := 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = f
+			}
+		}
+
+		if q > preference {
+			language, preference = tag, q
+		}
+	}
+
+	return language
+}
@@ -0,0 +1,91 @@
+package fpf
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCatalogTranslate(t *testing.T) {
+	tests := []struct {
+		locale  string
+		message Message
+		want    string
+		ok      bool
+	}{
+		{"en", Message{Code: CodeValueMissing}, "Please fill out this field.", true},
+		{"en-GB", Message{Code: CodeValueMissing}, "Please fill out this field.", true},
+		{"de_DE", Message{Code: CodeValueMissing}, "Bitte füllen Sie dieses Feld aus.", true},
+		{"en", Message{Code: CodeTooLong, Params: map[string]interface{}{"max": 1}}, "Please use no more than 1 character.", true},
+		{"en", Message{Code: CodeTooLong, Params: map[string]interface{}{"max": 0}}, "Please use no more than 0 characters.", true},
+		{"fr", Message{Code: CodeTooShort, Params: map[string]interface{}{"min": 0}}, "Veuillez utiliser au moins 0 caractère.", true},
+		{"fr-CA", Message{Code: CodeTooShort, Params: map[string]interface{}{"min": 5}}, "Veuillez utiliser au moins 5 caractères.", true},
+		{"de", Message{Code: CodeRangeOverflow, Params: map[string]interface{}{"max": "10"}}, "Bitte wählen Sie einen Wert, der nicht größer als 10 ist.", true},
+		{"es", Message{Code: CodeValueMissing}, "", false},
+		{"en", Message{Code: "unknown"}, "", false},
+		{"en", Message{Text: "no code"}, "", false},
+	}
+
+	for _, test := range tests {
+		got, ok := DefaultCatalog.Translate(test.locale, test.message)
+		if got != test.want || ok != test.ok {
+			t.Errorf("Translate(%q, %v) = %q, %v, expected %q, %v", test.locale, test.message.Code, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	html := `<form id="a"><input name="foo" required><input name="bar"></form><form id="b"><input name="foo" required></form>`
+	want := `<form id="a"><input name="foo" required="" class="error"/><ul class="errors"><li>Bitte füllen Sie dieses Feld aus.</li></ul><input name="bar" value="ab" class="error"/><ul class="errors"><li>Please use no more than 1 character.</li><li>custom</li></ul></form><form id="b"><input name="foo" required="" class="error"/><ul class="errors"><li>Please fill out this field.</li></ul></form>`
+
+	forms := []Form{
+		{
+			ID:     "a",
+			Locale: "de",
+			Values: map[string][]string{"bar": {"ab"}},
+			Incidents: []Incident{
+				{Names: []string{"bar"}, Messages: []Message{{Code: CodeTooLong, Params: map[string]interface{}{"max": 1}}, {Code: "custom", Text: "custom"}}},
+			},
+		},
+		{ID: "b", Values: url.Values{}},
+	}
+
+	fpf := New()
+	fpf.Fragment = true
+	fpf.Validate = true
+	fpf.Translator = TranslatorFunc(func(locale string, message Message) (string, bool) {
+		if message.Code == CodeTooLong {
+			locale = "en"
+		}
+		return DefaultCatalog.Translate(locale, message)
+	})
+
+	output := new(bytes.Buffer)
+	if err := fpf.Execute(forms, output, strings.NewReader(html)); err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), want)
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"de", "de"},
+		{"en-GB,en;q=0.8", "en-GB"},
+		{"fr;q=0.5, de;q=0.9, *", "de"},
+		{"*;q=0.9, en;q=0", ""},
+		{"en;q=0.5, fr;q=0.5", "en"},
+	}
+
+	for _, test := range tests {
+		if got := acceptLanguage(test.header); got != test.want {
+			t.Errorf("acceptLanguage(%q) = %q, expected %q", test.header, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package fpf
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/saracen/fpf/attr"
+	"golang.org/x/net/html"
+)
+
+// ValidationMessages are the messages used for incidents created by
+// constraint validation. Messages that take an argument are passed to
+// fmt.Sprintf.
+type ValidationMessages struct {
+	ValueMissing      string // required
+	BadInput          string // number, range, date, time, etc. that failed to parse
+	TypeMismatchEmail string // type=email
+	TypeMismatchURL   string // type=url
+	PatternMismatch   string // pattern
+	TooLong           string // maxlength, given the maximum length
+	TooShort          string // minlength, given the minimum length
+	RangeUnderflow    string // min, given the minimum value
+	RangeOverflow     string // max, given the maximum value
+	StepMismatch      string // step, given the step value
+}
+
+// The codes of the messages of incidents created by constraint validation,
+// named after the validity states of the HTML specification. The maximum and
+// minimum lengths, values and step are provided as the message parameters
+// "max", "min" and "step".
+const (
+	CodeValueMissing      = "valueMissing"
+	CodeBadInput          = "badInput"
+	CodeTypeMismatchEmail = "typeMismatchEmail"
+	CodeTypeMismatchURL   = "typeMismatchURL"
+	CodePatternMismatch   = "patternMismatch"
+	CodeTooLong           = "tooLong"
+	CodeTooShort          = "tooShort"
+	CodeRangeUnderflow    = "rangeUnderflow"
+	CodeRangeOverflow     = "rangeOverflow"
+	CodeStepMismatch      = "stepMismatch"
+)
+
+// DefaultValidationMessages are the validation messages used if no other
+// validation messages are provided.
+var DefaultValidationMessages = &ValidationMessages{
+	ValueMissing:      "Please fill out this field.",
+	BadInput:          "Please enter a valid value.",
+	TypeMismatchEmail: "Please enter an email address.",
+	TypeMismatchURL:   "Please enter a URL.",
+	PatternMismatch:   "Please match the requested format.",
+	TooLong:           "Please use no more than %d characters.",
+	TooShort:          "Please use at least %d characters.",
+	RangeUnderflow:    "Please select a value that is no less than %s.",
+	RangeOverflow:     "Please select a value that is no more than %s.",
+	StepMismatch:      "Please select a value that is in steps of %s.",
+}
+
+// emailPattern is the valid e-mail address production from the HTML
+// specification.
+var emailPattern = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// floatPattern is the valid floating-point number production from the HTML
+// specification.
+var floatPattern = regexp.MustCompile(`^-?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+)(?:[eE][+-]?[0-9]+)?$`)
+
+// validate checks the submitted values of a form against the constraint
+// attributes of its elements and returns an incident for each element name
+// that fails. Forms that weren't submitted aren't checked.
+func (p *processor) validate(formId string) []Incident {
+	form := p.forms[formId]
+	if form.submitted == nil {
+		return nil
+	}
+
+	messages := p.ValidationMessages
+	if messages == nil {
+		messages = DefaultValidationMessages
+	}
+
+	var incidents []Incident
+	seen := make(map[string]bool)
+	for _, input := range form.inputs {
+		name := attr.Attributes(input.Attr).Get("name")
+		if seen[name] {
+			continue
+		}
+
+		// Submitted values are checked rather than those populated, which
+		// may be defaults, normalised, formatted or dropped
+		var value string
+		params := form.submitted[name]
+		if i := form.index[input]; i < len(params) {
+			value = params[i]
+		}
+		if message := messages.check(input, value, params); message.Code != "" {
+			seen[name] = true
+			incidents = append(incidents, Incident{
+				Names:    []string{name},
+				Messages: []Message{message},
+			})
+		}
+	}
+
+	return incidents
+}
+
+// check returns the message of the first constraint the element's value
+// fails, or a message without a code if the value is valid. params are all of
+// the values provided for the element's name.
+func (m *ValidationMessages) check(input *html.Node, value string, params []string) Message {
+	attributes := attr.Attributes(input.Attr)
+	if barred(input) {
+		return Message{}
+	}
+
+	typ := strings.ToLower(attributes.Get("type"))
+	if input.Data != "input" {
+		typ = input.Data
+	}
+
+	if attributes.Has("required") {
+		switch typ {
+		case "checkbox":
+			checked := false
+			for _, param := range params {
+				if !attributes.Has("value") || attributes.Get("value") == param {
+					checked = true
+				}
+			}
+			if !checked {
+				return Message{Code: CodeValueMissing, Text: m.ValueMissing}
+			}
+		case "range", "color":
+		default:
+			if value == "" {
+				return Message{Code: CodeValueMissing, Text: m.ValueMissing}
+			}
+		}
+	}
+
+	switch typ {
+	case "checkbox", "radio", "select", "color":
+		return Message{}
+	}
+
+	if value == "" {
+		return Message{}
+	}
+
+	switch typ {
+	case "email":
+		addresses := []string{value}
+		if attributes.Has("multiple") {
+			addresses = strings.Split(value, ",")
+		}
+		for _, address := range addresses {
+			if !emailPattern.MatchString(strings.TrimSpace(address)) {
+				return Message{Code: CodeTypeMismatchEmail, Text: m.TypeMismatchEmail}
+			}
+		}
+	case "url":
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" {
+			return Message{Code: CodeTypeMismatchURL, Text: m.TypeMismatchURL}
+		}
+	}
+
+	if _, ok := parseInputValue(typ, value); !ok && numericTypes[typ] {
+		return Message{Code: CodeBadInput, Text: m.BadInput}
+	}
+
+	if input.Data == "input" && attributes.Has("pattern") {
+		if pattern, err := regexp.Compile("^(?:" + attributes.Get("pattern") + ")$"); err == nil && !pattern.MatchString(value) {
+			return Message{Code: CodePatternMismatch, Text: m.PatternMismatch}
+		}
+	}
+
+	length := utf8.RuneCountInString(value)
+	if max, err := strconv.Atoi(attributes.Get("maxlength")); err == nil && max >= 0 && length > max {
+		return Message{
+			Code:   CodeTooLong,
+			Params: map[string]interface{}{"max": max},
+			Text:   fmt.Sprintf(m.TooLong, max),
+		}
+	}
+	if min, err := strconv.Atoi(attributes.Get("minlength")); err == nil && min >= 0 && length < min {
+		return Message{
+			Code:   CodeTooShort,
+			Params: map[string]interface{}{"min": min},
+			Text:   fmt.Sprintf(m.TooShort, min),
+		}
+	}
+
+	if !numericTypes[typ] {
+		return Message{}
+	}
+
+	n, _ := parseInputValue(typ, value)
+	if min, ok := parseInputValue(typ, attributes.Get("min")); ok && n < min {
+		return Message{
+			Code:   CodeRangeUnderflow,
+			Params: map[string]interface{}{"min": attributes.Get("min")},
+			Text:   fmt.Sprintf(m.RangeUnderflow, attributes.Get("min")),
+		}
+	}
+	if max, ok := parseInputValue(typ, attributes.Get("max")); ok && n > max {
+		return Message{
+			Code:   CodeRangeOverflow,
+			Params: map[string]interface{}{"max": attributes.Get("max")},
+			Text:   fmt.Sprintf(m.RangeOverflow, attributes.Get("max")),
+		}
+	}
+
+	step := defaultSteps[typ]
+	if attributes.Has("step") {
+		if strings.EqualFold(attributes.Get("step"), "any") {
+			return Message{}
+		}
+		if s, err := strconv.ParseFloat(attributes.Get("step"), 64); err == nil && s > 0 {
+			step = s
+		}
+	}
+
+	base, ok := parseInputValue(typ, attributes.Get("min"))
+	if !ok {
+		base, _ = parseInputValue(typ, attributes.Get("value"))
+	}
+
+	steps := (n - base) / step
+	if math.Abs(steps-math.Round(steps)) > 1e-9 {
+		step := strconv.FormatFloat(step, 'f', -1, 64)
+		return Message{
+			Code:   CodeStepMismatch,
+			Params: map[string]interface{}{"step": step},
+			Text:   fmt.Sprintf(m.StepMismatch, step),
+		}
+	}
+
+	return Message{}
+}
+
+// barred reports whether an element is barred from constraint validation.
+func barred(n *html.Node) bool {
+	attributes := attr.Attributes(n.Attr)
+	if attributes.Has("disabled") || attributes.Has("readonly") {
+		return true
+	}
+
+	switch n.Data {
+	case "input":
+		switch strings.ToLower(attributes.Get("type")) {
+		case "hidden", "submit", "reset", "button", "image", "file":
+			return true
+		}
+	case "select", "textarea":
+	default:
+		return true
+	}
+
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type != html.ElementNode {
+			continue
+		}
+		if p.Data == "datalist" || (p.Data == "fieldset" && attr.Attributes(p.Attr).Has("disabled")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// numericTypes are the input types whose values can be compared using min,
+// max and step.
+var numericTypes = map[string]bool{
+	"number":         true,
+	"range":          true,
+	"date":           true,
+	"month":          true,
+	"week":           true,
+	"time":           true,
+	"datetime-local": true,
+}
+
+// defaultSteps are the default steps of the numeric input types, in the unit
+// returned by parseInputValue.
+var defaultSteps = map[string]float64{
+	"number":         1,
+	"range":          1,
+	"date":           1,
+	"month":          1,
+	"week":           1,
+	"time":           60,
+	"datetime-local": 60,
+}
+
+// parseInputValue parses value according to the input type typ and returns
+// it as a number: days since epoch for dates, months since epoch for months,
+// weeks since epoch for weeks and seconds for times.
+func parseInputValue(typ, value string) (float64, bool) {
+	switch typ {
+	case "number", "range":
+		if !floatPattern.MatchString(value) {
+			return 0, false
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		return n, err == nil && !math.IsInf(n, 0)
+
+	case "date":
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return 0, false
+		}
+		return math.Floor(float64(t.Unix()) / 86400), true
+
+	case "month":
+		t, err := time.Parse("2006-01", value)
+		if err != nil {
+			return 0, false
+		}
+		return float64((t.Year()-1970)*12 + int(t.Month()) - 1), true
+
+	case "week":
+		t, ok := parseWeek(value)
+		if !ok {
+			return 0, false
+		}
+		return float64(t.Sub(time.Date(1969, 12, 29, 0, 0, 0, 0, time.UTC)) / (7 * 24 * time.Hour)), true
+
+	case "time":
+		for _, layout := range []string{"15:04", "15:04:05"} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return float64(t.Hour()*3600+t.Minute()*60+t.Second()) + float64(t.Nanosecond())/1e9, true
+			}
+		}
+
+	case "datetime-local":
+		for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return float64(t.Unix()) + float64(t.Nanosecond())/1e9, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// parseWeek parses a week string (e.g. "2017-W01") and returns the Monday
+// the week starts on.
+func parseWeek(value string) (time.Time, bool) {
+	if len(value) < 8 || value[len(value)-4:len(value)-2] != "-W" {
+		return time.Time{}, false
+	}
+
+	year, err := strconv.Atoi(value[:len(value)-4])
+	if err != nil || year < 1 {
+		return time.Time{}, false
+	}
+	week, err := strconv.Atoi(value[len(value)-2:])
+	if err != nil || week < 1 {
+		return time.Time{}, false
+	}
+
+	// The 28th of December is always in the last week of the year
+	if _, weeks := time.Date(year, 12, 28, 0, 0, 0, 0, time.UTC).ISOWeek(); week > weeks {
+		return time.Time{}, false
+	}
+
+	// The 4th of January is always in the first week of the year
+	jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+
+	return monday.AddDate(0, 0, (week-1)*7), true
+}
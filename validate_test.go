@@ -0,0 +1,143 @@
+package fpf
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+type validateTest struct {
+	Input  string
+	Values url.Values
+	Want   []string
+}
+
+var validateTests = []validateTest{
+	// required
+	{`<input type="text" name="foo" required>`, url.Values{}, []string{"Please fill out this field."}},
+	{`<input type="text" name="foo" required>`, url.Values{"foo": {""}}, []string{"Please fill out this field."}},
+	{`<input type="text" name="foo" required>`, url.Values{"foo": {"bar"}}, nil},
+	{`<input type="text" name="foo" required disabled>`, url.Values{}, nil},
+	{`<fieldset disabled><input type="text" name="foo" required></fieldset>`, url.Values{}, nil},
+	{`<input type="checkbox" name="foo" value="1" required>`, url.Values{"foo": {"2"}}, []string{"Please fill out this field."}},
+	{`<input type="checkbox" name="foo" value="1" required>`, url.Values{"foo": {"2", "1"}}, nil},
+	{`<input type="radio" name="foo" value="1" required><input type="radio" name="foo" value="2">`, url.Values{}, []string{"Please fill out this field."}},
+	{`<select name="foo" required><option value="">None</option></select>`, url.Values{"foo": {""}}, []string{"Please fill out this field."}},
+	{`<textarea name="foo" required></textarea>`, url.Values{}, []string{"Please fill out this field."}},
+
+	// length
+	{`<input type="text" name="foo" minlength="3">`, url.Values{"foo": {"ab"}}, []string{"Please use at least 3 characters."}},
+	{`<input type="text" name="foo" minlength="3">`, url.Values{"foo": {""}}, nil},
+	{`<input type="text" name="foo" maxlength="3">`, url.Values{"foo": {"abcd"}}, []string{"Please use no more than 3 characters."}},
+	{`<textarea name="foo" maxlength="3"></textarea>`, url.Values{"foo": {"äöü"}}, nil},
+
+	// pattern
+	{`<input type="text" name="foo" pattern="[a-z]+">`, url.Values{"foo": {"abc1"}}, []string{"Please match the requested format."}},
+	{`<input type="text" name="foo" pattern="[a-z]+">`, url.Values{"foo": {"abc"}}, nil},
+
+	// types
+	{`<input type="email" name="foo">`, url.Values{"foo": {"foo@example"}}, nil},
+	{`<input type="email" name="foo">`, url.Values{"foo": {"foo"}}, []string{"Please enter an email address."}},
+	{`<input type="email" name="foo" multiple>`, url.Values{"foo": {"foo@example.com, bar@example.com"}}, nil},
+	{`<input type="url" name="foo">`, url.Values{"foo": {"example.com"}}, []string{"Please enter a URL."}},
+	{`<input type="url" name="foo">`, url.Values{"foo": {"https://example.com"}}, nil},
+	{`<input type="number" name="foo">`, url.Values{"foo": {"1e3"}}, nil},
+	{`<input type="number" name="foo">`, url.Values{"foo": {"0x10"}}, []string{"Please enter a valid value."}},
+	{`<input type="date" name="foo">`, url.Values{"foo": {"2017-02-30"}}, []string{"Please enter a valid value."}},
+	{`<input type="week" name="foo">`, url.Values{"foo": {"2015-W53"}}, nil},
+	{`<input type="week" name="foo">`, url.Values{"foo": {"2017-W53"}}, []string{"Please enter a valid value."}},
+
+	// range
+	{`<input type="number" name="foo" min="1" max="10">`, url.Values{"foo": {"0"}}, []string{"Please select a value that is no less than 1."}},
+	{`<input type="number" name="foo" min="1" max="10">`, url.Values{"foo": {"11"}}, []string{"Please select a value that is no more than 10."}},
+	{`<input type="date" name="foo" min="2017-01-01">`, url.Values{"foo": {"2016-12-31"}}, []string{"Please select a value that is no less than 2017-01-01."}},
+	{`<input type="time" name="foo" max="17:00">`, url.Values{"foo": {"17:30"}}, []string{"Please select a value that is no more than 17:00."}},
+
+	// step
+	{`<input type="number" name="foo">`, url.Values{"foo": {"1.5"}}, []string{"Please select a value that is in steps of 1."}},
+	{`<input type="number" name="foo" step="any">`, url.Values{"foo": {"1.5"}}, nil},
+	{`<input type="number" name="foo" min="1" step="2">`, url.Values{"foo": {"5"}}, nil},
+	{`<input type="number" name="foo" min="1" step="2">`, url.Values{"foo": {"4"}}, []string{"Please select a value that is in steps of 2."}},
+	{`<input type="number" name="foo" step="0.1">`, url.Values{"foo": {"0.3"}}, nil},
+	{`<input type="date" name="foo" step="7" min="2017-01-02">`, url.Values{"foo": {"2017-01-16"}}, nil},
+	{`<input type="time" name="foo">`, url.Values{"foo": {"10:00:30"}}, []string{"Please select a value that is in steps of 60."}},
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range validateTests {
+		p := newProcessor(New(), []Form{{Values: test.Values}})
+
+		document, err := html.Parse(strings.NewReader(`<form>` + test.Input + `</form>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.traverse(document, formContext{})
+
+		var got []string
+		for _, incident := range p.validate("") {
+			got = append(got, incident.texts()...)
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.Want, "\n") {
+			t.Errorf("validate(`%s`, %v):\nGot:\n%v\nExpected:\n%v", test.Input, test.Values, got, test.Want)
+		}
+	}
+}
+
+func TestExecuteValidate(t *testing.T) {
+	input := `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo" minlength="5"></form></body></html>`
+	want := `<!DOCTYPE html><html><head></head><body><form action="/"><input type="text" name="foo" minlength="5" value="bar" class="error"/><ul class="errors"><li>Zu kurz (mindestens 5 Zeichen).</li></ul></form></body></html>`
+
+	messages := *DefaultValidationMessages
+	messages.TooShort = "Zu kurz (mindestens %d Zeichen)."
+
+	fpf := New()
+	fpf.Validate = true
+	fpf.ValidationMessages = &messages
+
+	output := new(bytes.Buffer)
+	err := fpf.Execute([]Form{{Values: url.Values{"foo": []string{"bar"}}}}, output, strings.NewReader(input))
+	if err != nil {
+		t.Error(err)
+	}
+	if output.String() != want {
+		t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", input, output.String(), want)
+	}
+}
+
+func TestValidateSubmitted(t *testing.T) {
+	html := `<form id="a"><input name="name" required><input name="code" minlength="5"></form>`
+	defaults := url.Values{"name": {"Bob"}, "code": {"abc"}}
+
+	tests := []struct {
+		values url.Values
+		want   string
+	}{
+		// not submitted
+		{
+			nil,
+			`<form id="a"><input name="name" required="" value="Bob"/><input name="code" minlength="5" value="abc"/></form>`,
+		},
+		// submitted values are checked, not defaults
+		{
+			url.Values{"code": {"abcdef"}},
+			`<form id="a"><input name="name" required="" value="Bob" class="error"/><ul class="errors"><li>Please fill out this field.</li></ul><input name="code" minlength="5" value="abcdef"/></form>`,
+		},
+	}
+
+	fpf := New()
+	fpf.Fragment = true
+	fpf.Validate = true
+	for _, test := range tests {
+		output := new(bytes.Buffer)
+		if err := fpf.Execute([]Form{{ID: "a", Values: test.values, Defaults: defaults}}, output, strings.NewReader(html)); err != nil {
+			t.Error(err)
+		}
+		if output.String() != test.want {
+			t.Errorf("Execute(`%s`):\nGot:\n%s\nExpected:\n%s", html, output.String(), test.want)
+		}
+	}
+}